@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ClockJumpThreshold is the minimum offset between the wall clock and the monotonic clock that is treated as a
+// suspend or a wall clock change. Smaller offsets are caused by NTP adjustments and scheduling delays.
+const ClockJumpThreshold = 5 * time.Second
+
+// ClockWatcher detects suspends and wall clock changes between loop iterations. The monotonic clock is not affected
+// by wall clock changes and does not advance while the system is suspended, so the difference between the elapsed
+// wall clock time and the elapsed monotonic time is the time spent suspended plus the size of any wall clock change.
+type ClockWatcher struct {
+	Wall      time.Time
+	Monotonic time.Duration
+
+	// start is the reference for monotonic clock readings.
+	start time.Time
+	// interval is the monotonic time between the last two updates.
+	interval time.Duration
+}
+
+func NewClockWatcher() *ClockWatcher {
+	start := time.Now()
+	return &ClockWatcher{Wall: start.Round(0), Monotonic: 0, start: start, interval: 0}
+}
+
+// Check reads the current time and returns the offset since the previous call, see [ClockWatcher.Update].
+func (w *ClockWatcher) Check() time.Duration {
+	if w == nil {
+		return 0
+	}
+
+	now := time.Now()
+	return w.Update(now.Round(0), now.Sub(w.start))
+}
+
+// Update stores the current wall clock time and monotonic time and returns by how much the wall clock advanced more
+// than the monotonic clock since the previous update (negative if the wall clock was set back). Offsets smaller than
+// [ClockJumpThreshold] are ignored and returned as 0.
+func (w *ClockWatcher) Update(wall time.Time, monotonic time.Duration) time.Duration {
+	w.interval = monotonic - w.Monotonic
+	offset := wall.Sub(w.Wall) - w.interval
+	w.Wall = wall
+	w.Monotonic = monotonic
+
+	if offset.Abs() < ClockJumpThreshold {
+		return 0
+	}
+	return offset
+}
+
+// Interval returns the monotonic time between the last two updates, i.e., the time between the start of the previous
+// and the current loop iteration.
+func (w *ClockWatcher) Interval() time.Duration {
+	if w == nil {
+		return 0
+	}
+	return w.interval
+}
+
+// AdjustTimestamps shifts the start timestamps of all tracks in progress by offset, so they reflect when listening
+// actually started after the system was suspended (playback was paused in the meantime) or the wall clock was changed.
+// Timestamps are never moved into the future.
+func (l *MainLoop) AdjustTimestamps(offset time.Duration) {
+	now := time.Now()
+
+	for player, status := range l.PreviouslyPlaying {
+		if status.Timestamp.IsZero() {
+			continue
+		}
+
+		adjusted := status.Timestamp.Add(offset)
+		if adjusted.After(now) {
+			adjusted = now
+		}
+
+		log.Info().
+			Str("player", player).
+			Time("before", status.Timestamp).
+			Time("after", adjusted).
+			Msg("adjusting start timestamp of track in progress")
+
+		status.Timestamp = adjusted
+		l.PreviouslyPlaying[player] = status
+	}
+}
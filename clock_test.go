@@ -0,0 +1,53 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockWatcher(t *testing.T) {
+	watcher := main.NewClockWatcher()
+	require.Zero(t, watcher.Check())
+
+	wall := watcher.Wall
+	monotonic := watcher.Monotonic
+
+	// regular iteration
+	wall = wall.Add(2 * time.Second)
+	monotonic += 2 * time.Second
+	require.Zero(t, watcher.Update(wall, monotonic))
+
+	// suspended for an hour
+	wall = wall.Add(time.Hour + 2*time.Second)
+	monotonic += 2 * time.Second
+	require.Equal(t, time.Hour, watcher.Update(wall, monotonic))
+
+	// wall clock set back
+	wall = wall.Add(-10 * time.Minute)
+	monotonic += 2 * time.Second
+	require.Equal(t, -10*time.Minute-2*time.Second, watcher.Update(wall, monotonic))
+
+	var nilWatcher *main.ClockWatcher
+	require.Zero(t, nilWatcher.Check())
+}
+
+func TestMainLoopAdjustTimestamps(t *testing.T) {
+	loop := main.NewMainLoop(main.DefaultConfig, []main.Source{}, []main.Sink{}, nil)
+
+	started := time.Now().Add(-2 * time.Hour)
+	status := defaultPlaybackStatus
+	status.Timestamp = started
+	loop.PreviouslyPlaying["fake player"] = status
+	loop.PreviouslyPlaying["empty player"] = main.PlaybackStatus{}
+
+	loop.AdjustTimestamps(time.Hour)
+	require.Equal(t, started.Add(time.Hour), loop.PreviouslyPlaying["fake player"].Timestamp)
+	require.True(t, loop.PreviouslyPlaying["empty player"].Timestamp.IsZero())
+
+	// never in the future
+	loop.AdjustTimestamps(2 * time.Hour)
+	require.False(t, loop.PreviouslyPlaying["fake player"].Timestamp.After(time.Now()))
+}
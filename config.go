@@ -1,10 +1,13 @@
 package main
 
 import (
-	"net/http"
+	"bytes"
+	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 
 	"github.com/BurntSushi/toml"
 	"github.com/godbus/dbus/v5"
@@ -15,19 +18,51 @@ import (
 const DefaultConfigFileName = "config.toml"
 
 var DefaultConfig = Config{
+	Include:             nil,
+	Profiles:            nil,
 	PollRate:            2,
 	MinPlaybackDuration: 4 * 60,
 	MinPlaybackPercent:  50,
 	Blacklist:           []string{},
 	Regexes:             []RegexReplace{},
+	MissingMetadata:     []MissingMetadataConfig{},
+	Streams:             []StreamConfig{},
 	NotifyOnScrobble:    false,
 	NotifyOnError:       true,
+	LearnCorrections:    false,
+	EventLog:            "",
+	MetricsAddress:      "",
+	Deduplication: DeduplicationConfig{
+		Enabled:        true,
+		Window:         30,
+		SourcePriority: []string{},
+	},
+	MusicBrainz: MusicBrainzConfig{
+		Enabled:  false,
+		BaseURL:  MusicBrainzBaseURL,
+		Fields:   []string{MusicBrainzFieldAlbum, MusicBrainzFieldMBID},
+		MinScore: MusicBrainzDefaultMinScore,
+	},
+	ContentFilter: ContentFilterConfig{
+		Enabled:     true,
+		Genres:      []string{"(?i)podcast", "(?i)audio ?book", "(?i)spoken word"},
+		URLSchemes:  []string{},
+		URLHosts:    []string{"youtube.com", "www.youtube.com", "m.youtube.com", "youtu.be", "www.twitch.tv"},
+		TrackIDs:    []string{},
+		MinDuration: 0,
+		MaxDuration: 0,
+	},
 	Sources: SourcesConfig{
 		DBus:         &DBusConfig{Address: ""},
 		MediaControl: &MediaControlConfig{Command: "media-control", Arguments: []string{"get", "--now"}},
 		TidalHifi: &TidalHifiConfig{
 			Endpoint: "http://localhost:47836/current",
 		},
+		Webhook:     nil,
+		LastFmProxy: nil,
+		HTTP:        map[string]HTTPConfig{},
+		Jellyfin:    map[string]JellyfinConfig{},
+		Subsonic:    map[string]SubsonicConfig{},
 	},
 	Sinks: SinksConfig{
 		//nolint:gosec
@@ -45,14 +80,27 @@ var DefaultConfig = Config{
 }
 
 type Config struct {
+	Include  []string          `toml:"include,omitempty"`
+	Profiles map[string]Config `toml:"profiles,omitempty"`
+
 	PollRate            int            `toml:"poll_rate"`
 	MinPlaybackDuration int            `toml:"min_playback_duration"`
 	MinPlaybackPercent  int            `toml:"min_playback_percent"`
 	NotifyOnScrobble    bool           `toml:"notify_on_scrobble"`
 	NotifyOnError       bool           `toml:"notify_on_error"`
+	LearnCorrections    bool           `toml:"learn_corrections"`
+	EventLog            string         `toml:"event_log"`
+	MetricsAddress      string         `toml:"metrics_address"`
 	Blacklist           []string       `toml:"blacklist"`
 	Regexes             []RegexReplace `toml:"regexes"`
 
+	MissingMetadata []MissingMetadataConfig `toml:"missing_metadata"`
+	Streams         []StreamConfig          `toml:"streams"`
+
+	Deduplication DeduplicationConfig `toml:"deduplication"`
+	ContentFilter ContentFilterConfig `toml:"content_filter"`
+	MusicBrainz   MusicBrainzConfig   `toml:"musicbrainz"`
+
 	Sources SourcesConfig `toml:"sources"`
 	Sinks   SinksConfig   `toml:"sinks"`
 }
@@ -65,10 +113,59 @@ type RegexReplace struct {
 	Album   bool   `toml:"album"`
 }
 
+// MissingMetadataConfig configures how tracks without album or duration are handled for players matching Player.
+// DurationThreshold is in seconds.
+type MissingMetadataConfig struct {
+	Player            string `toml:"player"`
+	AllowEmptyAlbum   bool   `toml:"allow_empty_album"`
+	DurationThreshold int    `toml:"duration_threshold"`
+}
+
+// StreamConfig enables the stream mode for players matching Player. ListenThreshold is in seconds.
+type StreamConfig struct {
+	Player          string   `toml:"player"`
+	Patterns        []string `toml:"patterns"`
+	Ignore          []string `toml:"ignore"`
+	ListenThreshold int      `toml:"listen_threshold"`
+}
+
+type DeduplicationConfig struct {
+	Enabled        bool     `toml:"enabled"`
+	Window         int      `toml:"window"`
+	SourcePriority []string `toml:"source_priority"`
+}
+
+// ContentFilterConfig configures filters for content that is not music. MinDuration and MaxDuration are in seconds,
+// 0 disables the bound.
+type ContentFilterConfig struct {
+	Enabled     bool     `toml:"enabled"`
+	Genres      []string `toml:"genres"`
+	URLSchemes  []string `toml:"url_schemes"`
+	URLHosts    []string `toml:"url_hosts"`
+	TrackIDs    []string `toml:"track_ids"`
+	MinDuration int      `toml:"min_duration"`
+	MaxDuration int      `toml:"max_duration"`
+}
+
+// MusicBrainzConfig configures the metadata enrichment, see [MusicBrainz]. Fields lists the fields that are filled
+// in: "album" (only if missing), "artist" (canonical artist credit), and "mbid".
+type MusicBrainzConfig struct {
+	Enabled  bool     `toml:"enabled"`
+	BaseURL  string   `toml:"base_url"`
+	Fields   []string `toml:"fields"`
+	MinScore int      `toml:"min_score"`
+}
+
 type SourcesConfig struct {
 	DBus         *DBusConfig         `toml:"dbus"`
 	MediaControl *MediaControlConfig `toml:"media-control"`
 	TidalHifi    *TidalHifiConfig    `toml:"tidal-hifi"`
+
+	Webhook     *WebhookConfig            `toml:"webhook"`
+	LastFmProxy *LastFmProxyConfig        `toml:"lastfm-proxy"`
+	HTTP        map[string]HTTPConfig     `toml:"http"`
+	Jellyfin    map[string]JellyfinConfig `toml:"jellyfin"`
+	Subsonic    map[string]SubsonicConfig `toml:"subsonic"`
 }
 
 type SinksConfig struct {
@@ -89,6 +186,53 @@ type TidalHifiConfig struct {
 	Endpoint string `toml:"endpoint"`
 }
 
+type WebhookConfig struct {
+	Address string `toml:"address"`
+	Secret  string `toml:"secret"`
+}
+
+type LastFmProxyConfig struct {
+	Address string            `toml:"address"`
+	Key     string            `toml:"key"`
+	Secret  string            `toml:"secret"`
+	Users   map[string]string `toml:"users"`
+}
+
+type HTTPConfig struct {
+	URL      string            `toml:"url"`
+	Headers  map[string]string `toml:"headers"`
+	Username string            `toml:"username"`
+	Password string            `toml:"password"`
+
+	Fields HTTPFieldsConfig `toml:"fields"`
+}
+
+type HTTPFieldsConfig struct {
+	Artist          string            `toml:"artist"`
+	ArtistSeparator string            `toml:"artist_separator"`
+	Track           string            `toml:"track"`
+	Album           string            `toml:"album"`
+	Duration        string            `toml:"duration"`
+	DurationUnit    string            `toml:"duration_unit"`
+	Position        string            `toml:"position"`
+	PositionUnit    string            `toml:"position_unit"`
+	State           string            `toml:"state"`
+	States          map[string]string `toml:"states"`
+}
+
+type JellyfinConfig struct {
+	URL      string `toml:"url"`
+	APIKey   string `toml:"api_key"`
+	Username string `toml:"username"`
+}
+
+type SubsonicConfig struct {
+	URL      string `toml:"url"`
+	APIKey   string `toml:"api_key"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
 type LastFmConfig struct {
 	BaseURL    string `toml:"base_url"`
 	Key        string `toml:"key"`
@@ -101,9 +245,49 @@ type CSVConfig struct {
 	Filename string `toml:"filename"`
 }
 
+// SourceSetup is the result of setting up a configured source. Key identifies the config entry (e.g.,
+// `jellyfin.home`), Error is set if the source could not be set up.
+type SourceSetup struct {
+	Key    string
+	Source Source
+	Error  error
+}
+
+// SinkSetup is the result of setting up a configured sink, see [SourceSetup].
+type SinkSetup struct {
+	Key   string
+	Sink  Sink
+	Error error
+}
+
 func (c Config) SetupSources() []Source {
 	var sources []Source
 
+	for _, setup := range c.SourceSetups() {
+		if setup.Error != nil {
+			log.Error().
+				Err(setup.Error).
+				Str("key", setup.Key).
+				Msg("error setting up source")
+			continue
+		}
+		sources = append(sources, setup.Source)
+	}
+
+	if len(sources) == 0 {
+		log.Warn().Msg("no sources configured")
+	} else {
+		log.Debug().Msg("set up sources")
+	}
+
+	return sources
+}
+
+// SourceSetups sets up all configured sources, including the ones that failed. Entries of the same type are
+// sorted by key.
+func (c Config) SourceSetups() []SourceSetup {
+	var setups []SourceSetup
+
 	if c.Sources.DBus != nil {
 		log.Debug().Msg("setting up dbus source")
 
@@ -118,20 +302,25 @@ func (c Config) SetupSources() []Source {
 		}
 
 		if err != nil {
-			log.Error().
-				Err(err).
-				Str("address", c.Sources.DBus.Address).
-				Msg("failed to connect to bus")
+			setups = append(setups, SourceSetup{
+				Key:    "dbus",
+				Source: nil,
+				Error:  fmt.Errorf("failed to connect to bus: %w", err),
+			})
 		} else {
-			sources = append(sources, DBusSource{Conn: conn})
+			setups = append(setups, SourceSetup{Key: "dbus", Source: DBusSource{Conn: conn}, Error: nil})
 		}
 	}
 
 	if c.Sources.MediaControl != nil {
 		log.Debug().Msg("setting up media-control source")
-		sources = append(sources, MediaControlSource{
-			Command:   c.Sources.MediaControl.Command,
-			Arguments: c.Sources.MediaControl.Arguments,
+		setups = append(setups, SourceSetup{
+			Key: "media-control",
+			Source: MediaControlSource{
+				Command:   c.Sources.MediaControl.Command,
+				Arguments: c.Sources.MediaControl.Arguments,
+			},
+			Error: nil,
 		})
 	}
 
@@ -145,51 +334,121 @@ func (c Config) SetupSources() []Source {
 		}
 
 		log.Debug().Msg("setting up tidal-hifi API source")
-		sources = append(sources, TidalHifiSource{
-			Client:   http.Client{},
-			Endpoint: endpoint,
+		setups = append(setups, SourceSetup{Key: "tidal-hifi", Source: TidalHifiSource(endpoint), Error: nil})
+	}
+
+	if c.Sources.Webhook != nil {
+		log.Debug().Msg("setting up webhook source")
+		setups = append(setups, SourceSetup{
+			Key:    "webhook",
+			Source: WebhookSourceFromConfig(*c.Sources.Webhook),
+			Error:  nil,
 		})
 	}
 
-	if len(sources) == 0 {
-		log.Warn().Msg("no sources configured")
-	} else {
-		log.Debug().Msg("set up sources")
+	if c.Sources.LastFmProxy != nil {
+		log.Debug().Msg("setting up last.fm proxy source")
+		setups = append(setups, SourceSetup{
+			Key:    "lastfm-proxy",
+			Source: LastFmProxySourceFromConfig(*c.Sources.LastFmProxy),
+			Error:  nil,
+		})
 	}
 
-	return sources
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.HTTP)) {
+		log.Debug().
+			Str("key", key).
+			Msg("setting up HTTP source")
+		setups = append(setups, SourceSetup{
+			Key:    "http." + key,
+			Source: HTTPSourceFromConfig(key, c.Sources.HTTP[key]),
+			Error:  nil,
+		})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.Jellyfin)) {
+		log.Debug().
+			Str("key", key).
+			Msg("setting up Jellyfin source")
+		setups = append(setups, SourceSetup{
+			Key:    "jellyfin." + key,
+			Source: JellyfinSourceFromConfig(c.Sources.Jellyfin[key]),
+			Error:  nil,
+		})
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.Subsonic)) {
+		log.Debug().
+			Str("key", key).
+			Msg("setting up Subsonic source")
+		setups = append(setups, SourceSetup{
+			Key:    "subsonic." + key,
+			Source: SubsonicSourceFromConfig(c.Sources.Subsonic[key]),
+			Error:  nil,
+		})
+	}
+
+	return setups
 }
 
 func (c Config) SetupSinks() []Sink {
 	var sinks []Sink
+	for _, setup := range c.WorkingSinkSetups() {
+		sinks = append(sinks, setup.Sink)
+	}
+	return sinks
+}
 
-	for _, sinkConfig := range c.Sinks.LastFm {
-		log.Debug().Msg("setting up last.fm sink")
+// WorkingSinkSetups returns the sinks that were set up successfully, with their keys. Errors are logged.
+func (c Config) WorkingSinkSetups() []SinkSetup {
+	var setups []SinkSetup
 
-		sink, err := LastFmSinkFromConfig(sinkConfig)
-		if err != nil {
+	for _, setup := range c.SinkSetups() {
+		if setup.Error != nil {
 			log.Error().
-				Err(err).
-				Msg("error setting up last.fm sink")
-		} else {
-			sinks = append(sinks, sink)
+				Err(setup.Error).
+				Str("key", setup.Key).
+				Msg("error setting up sink")
+			continue
 		}
+		setups = append(setups, setup)
 	}
 
-	for _, sinkConfig := range c.Sinks.CSV {
-		log.Debug().Msg("setting up CSV sink")
-
-		sink := CSVSinkFromConfig(sinkConfig)
-		sinks = append(sinks, sink)
-	}
-
-	if len(sinks) == 0 {
+	if len(setups) == 0 {
 		log.Warn().Msg("no sinks configured")
 	} else {
 		log.Debug().Msg("set up sinks")
 	}
 
-	return sinks
+	return setups
+}
+
+// SinkSetups sets up all configured sinks, including the ones that failed. Entries of the same type are sorted
+// by key.
+func (c Config) SinkSetups() []SinkSetup {
+	var setups []SinkSetup
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sinks.LastFm)) {
+		log.Debug().
+			Str("key", key).
+			Msg("setting up last.fm sink")
+
+		sink, err := LastFmSinkFromConfig(c.Sinks.LastFm[key])
+		if err != nil {
+			setups = append(setups, SinkSetup{Key: "lastfm." + key, Sink: nil, Error: err})
+		} else {
+			setups = append(setups, SinkSetup{Key: "lastfm." + key, Sink: sink, Error: nil})
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sinks.CSV)) {
+		log.Debug().
+			Str("key", key).
+			Msg("setting up CSV sink")
+		setups = append(setups, SinkSetup{Key: "csv." + key, Sink: CSVSinkFromConfig(c.Sinks.CSV[key]), Error: nil})
+	}
+
+	return setups
 }
 
 func (c Config) ParseRegexes() []ParsedRegexReplace {
@@ -217,28 +476,48 @@ func (c Config) ParseRegexes() []ParsedRegexReplace {
 	return parsed
 }
 
+// ConfigOptions control how [LoadConfig] reads the config file.
+type ConfigOptions struct {
+	// Strict returns [ConfigErrors] instead of replacing invalid values.
+	Strict bool
+	// Profile selects the `[profiles.<name>]` sections merged into the config.
+	Profile string
+}
+
 func ReadConfig(filename string) (Config, error) {
-	log.Debug().Msg("creating config directory")
-	directory := filepath.Dir(filename)
-	if err := os.MkdirAll(directory, 0700); err != nil {
+	return LoadConfig(filename, ConfigOptions{Strict: false, Profile: ""})
+}
+
+// LoadConfig reads the config file and included files, adds saved credentials, and resolves secret references.
+func LoadConfig(filename string, options ConfigOptions) (Config, error) {
+	config, err := EffectiveConfig(filename, options)
+	if err != nil {
 		return Config{}, err
 	}
 
-	log.Debug().Msg("reading config")
-	var config Config
-	_, err := toml.DecodeFile(filename, &config)
+	if err := applySecrets(filename, &config); err != nil {
+		return Config{}, err
+	}
 
-	switch {
-	case os.IsNotExist(err):
-		config = DefaultConfig
+	return config, nil
+}
+
+// EffectiveConfig returns the merged and validated config, without credentials and with unresolved secret
+// references.
+func EffectiveConfig(filename string, options ConfigOptions) (Config, error) {
+	files, err := ReadConfigFiles(filename)
+	if err != nil {
+		return Config{}, err
+	}
 
-		log.Info().
-			Str("filename", filename).
-			Msg("creating default configuration file")
-		if err := DefaultConfig.Write(filename); err != nil {
-			return Config{}, err
+	if options.Strict {
+		if errs := CheckConfigFiles(files); len(errs) > 0 {
+			return Config{}, errs
 		}
-	case err != nil:
+	}
+
+	config, err := MergeConfigFiles(files, options.Profile)
+	if err != nil {
 		return Config{}, err
 	}
 
@@ -249,27 +528,33 @@ func ReadConfig(filename string) (Config, error) {
 	return config, nil
 }
 
+// applySecrets adds saved credentials to the config and resolves secret references.
+func applySecrets(configFilename string, config *Config) error {
+	credentials, err := ReadCredentials(CredentialsFilename(configFilename))
+	if err != nil {
+		return fmt.Errorf("cannot read credentials file: %w", err)
+	}
+
+	credentials.Apply(config)
+
+	var resolver SecretResolver
+	defer resolver.Close()
+
+	return config.ResolveSecrets(&resolver)
+}
+
 func (c *Config) Validate() {
 	log.Debug().Msg("validating configuration")
 
-	if c.PollRate <= 0 || c.PollRate > 60 {
-		log.Warn().
-			Int("poll_rate", c.PollRate).
-			Msg("invalid poll rate, using default value")
-		c.PollRate = 2
-	}
-	if c.MinPlaybackDuration <= 0 || c.MinPlaybackDuration > 20*60 {
-		log.Warn().
-			Int("min_playback_duration", c.MinPlaybackDuration).
-			Msg("invalid minimum playback duration, using default value")
-		// https://www.last.fm/api/scrobbling#when-is-a-scrobble-a-scrobble
-		c.MinPlaybackDuration = 4 * 60
-	}
-	if c.MinPlaybackPercent <= 0 || c.MinPlaybackPercent > 100 {
-		log.Warn().
-			Int("min_playback_percent", c.MinPlaybackPercent).
-			Msg("invalid minimum playback percentage, using default value")
-		c.MinPlaybackPercent = 50
+	for _, r := range c.ranges() {
+		if *r.Value < r.Min || *r.Value > r.Max {
+			log.Warn().
+				Str("key", r.Key).
+				Int("value", *r.Value).
+				Int("default", r.Default).
+				Msg("invalid value, using default value")
+			*r.Value = r.Default
+		}
 	}
 
 	if !c.NotifyOnError {
@@ -281,6 +566,57 @@ func (c *Config) Validate() {
 		c.Sources.MediaControl.Arguments = []string{"get", "--now"}
 	}
 
+	for key, httpConfig := range c.Sources.HTTP {
+		if httpConfig.URL == "" {
+			log.Warn().
+				Str("key", key).
+				Msg("HTTP source has no URL, ignoring it")
+			delete(c.Sources.HTTP, key)
+			continue
+		}
+		if _, err := DurationUnit(httpConfig.Fields.DurationUnit); err != nil {
+			log.Warn().
+				Str("key", key).
+				Err(err).
+				Msg("invalid duration unit for HTTP source, using seconds")
+			httpConfig.Fields.DurationUnit = "s"
+		}
+		if _, err := DurationUnit(httpConfig.Fields.PositionUnit); err != nil {
+			log.Warn().
+				Str("key", key).
+				Err(err).
+				Msg("invalid position unit for HTTP source, using seconds")
+			httpConfig.Fields.PositionUnit = "s"
+		}
+		c.Sources.HTTP[key] = httpConfig
+	}
+
+	if c.Sources.LastFmProxy != nil {
+		proxyConfig := c.Sources.LastFmProxy
+		if proxyConfig.Key == "" || proxyConfig.Secret == "" || len(proxyConfig.Users) == 0 {
+			log.Warn().Msg("last.fm proxy source requires an API key, a secret, and at least one user, ignoring it")
+			c.Sources.LastFmProxy = nil
+		}
+	}
+
+	for key, jellyfinConfig := range c.Sources.Jellyfin {
+		if jellyfinConfig.URL == "" || jellyfinConfig.APIKey == "" {
+			log.Warn().
+				Str("key", key).
+				Msg("Jellyfin source requires a URL and an API key, ignoring it")
+			delete(c.Sources.Jellyfin, key)
+		}
+	}
+
+	for key, subsonicConfig := range c.Sources.Subsonic {
+		if subsonicConfig.URL == "" || (subsonicConfig.APIKey == "" && subsonicConfig.Username == "") {
+			log.Warn().
+				Str("key", key).
+				Msg("Subsonic source requires a URL and an API key or username/password, ignoring it")
+			delete(c.Sources.Subsonic, key)
+		}
+	}
+
 	log.Debug().Msg("validated configuration")
 }
 
@@ -289,16 +625,16 @@ func (c Config) Write(filename string) error {
 		Str("filename", filename).
 		Msg("writing config file")
 
-	//nolint:gosec
-	file, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
+	var buffer bytes.Buffer
 
-	encoder := toml.NewEncoder(file)
+	encoder := toml.NewEncoder(&buffer)
 	encoder.Indent = ""
 
-	return encoder.Encode(c)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filename, buffer.Bytes(), 0600)
 }
 
 func ConfigDir() string {
@@ -309,3 +645,21 @@ func ConfigDir() string {
 	}
 	return filepath.Join(os.Getenv("HOME"), ".config", "goscrobble")
 }
+
+func CacheDir() string {
+	// https://specifications.freedesktop.org/basedir-spec/latest/
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome != "" {
+		return filepath.Join(cacheHome, "goscrobble")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".cache", "goscrobble")
+}
+
+func StateDir() string {
+	// https://specifications.freedesktop.org/basedir-spec/latest/
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome != "" {
+		return filepath.Join(stateHome, "goscrobble")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".local", "state", "goscrobble")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ConfigError is a problem found by strict config validation. File is only set for included files, Line is 0 if
+// the key is not set in the config file.
+type ConfigError struct {
+	File    string
+	Line    int
+	Key     string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	var location string
+	switch {
+	case e.File != "" && e.Line > 0:
+		location = fmt.Sprintf("%s, line %d: ", e.File, e.Line)
+	case e.File != "":
+		location = e.File + ": "
+	case e.Line > 0:
+		location = fmt.Sprintf("line %d: ", e.Line)
+	}
+	return fmt.Sprintf("%s%s: %s", location, e.Key, e.Message)
+}
+
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("found %d problem(s) in config file:", len(e)))
+	for _, configError := range e {
+		lines = append(lines, "  "+configError.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// configRange is an integer setting that must be within [Min, Max]. Non-strict validation replaces invalid values
+// with Default.
+type configRange struct {
+	Key     string
+	Value   *int
+	Min     int
+	Max     int
+	Default int
+}
+
+func (c *Config) ranges() []configRange {
+	return []configRange{
+		{Key: "poll_rate", Value: &c.PollRate, Min: 1, Max: 60, Default: 2},
+		// https://www.last.fm/api/scrobbling#when-is-a-scrobble-a-scrobble
+		{Key: "min_playback_duration", Value: &c.MinPlaybackDuration, Min: 1, Max: 20 * 60, Default: 4 * 60},
+		{Key: "min_playback_percent", Value: &c.MinPlaybackPercent, Min: 1, Max: 100, Default: 50},
+		{Key: "deduplication.window", Value: &c.Deduplication.Window, Min: 1, Max: 10 * 60, Default: 30},
+	}
+}
+
+// Check validates a config file without modifying it. Unlike [Config.Validate], it reports unknown keys, invalid
+// regular expressions, out-of-range values, and incomplete sources as errors. The config file contents are used
+// to look up line numbers.
+func (c Config) Check(meta toml.MetaData, data []byte) ConfigErrors {
+	lines := ConfigKeyLines(data)
+
+	var errs ConfigErrors
+	for _, key := range meta.Undecoded() {
+		errs = append(errs, ConfigError{
+			File:    "",
+			Line:    lines.Line(key.String(), 0),
+			Key:     key.String(),
+			Message: "unknown key",
+		})
+	}
+
+	errs = append(errs, c.check(meta, lines, "")...)
+
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		profile := c.Profiles[name]
+		prefix := "profiles." + name + "."
+
+		if len(profile.Include) > 0 || len(profile.Profiles) > 0 {
+			errs = append(errs, ConfigError{
+				File:    "",
+				Line:    lines.Line("profiles."+name, 0),
+				Key:     "profiles." + name,
+				Message: "profiles cannot contain `include` or `profiles`",
+			})
+		}
+		errs = append(errs, profile.check(meta, lines, prefix)...)
+	}
+
+	// errors without line numbers are printed last
+	slices.SortStableFunc(errs, func(a, b ConfigError) int {
+		switch {
+		case a.Line == b.Line:
+			return 0
+		case a.Line == 0:
+			return 1
+		case b.Line == 0:
+			return -1
+		default:
+			return a.Line - b.Line
+		}
+	})
+
+	return errs
+}
+
+// check validates the values of a config file or of a profile section, prefix is prepended to all keys.
+func (c Config) check(meta toml.MetaData, lines KeyLines, prefix string) ConfigErrors {
+	var errs ConfigErrors
+	add := func(key string, occurrence int, format string, args ...any) {
+		errs = append(errs, ConfigError{
+			File:    "",
+			Line:    lines.Line(prefix+key, occurrence),
+			Key:     prefix + key,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, r := range c.ranges() {
+		// missing values are replaced with defaults
+		if !meta.IsDefined(strings.Split(prefix+r.Key, ".")...) {
+			continue
+		}
+		if *r.Value < r.Min || *r.Value > r.Max {
+			add(r.Key, 0, "must be between %d and %d (got %d)", r.Min, r.Max, *r.Value)
+		}
+	}
+
+	checkRegex := func(key string, occurrence int, expression string) {
+		if _, err := regexp.Compile(expression); err != nil {
+			add(key, occurrence, "invalid regular expression %q: %s", expression, err.Error())
+		}
+	}
+	for i, expression := range c.Blacklist {
+		checkRegex(fmt.Sprintf("blacklist[%d]", i), 0, expression)
+	}
+	for i, r := range c.Regexes {
+		checkRegex(fmt.Sprintf("regexes[%d].match", i), i, r.Match)
+	}
+	for i, m := range c.MissingMetadata {
+		checkRegex(fmt.Sprintf("missing_metadata[%d].player", i), i, m.Player)
+		if m.DurationThreshold < 0 {
+			add(fmt.Sprintf("missing_metadata[%d].duration_threshold", i), i,
+				"must not be negative (got %d)", m.DurationThreshold)
+		}
+	}
+	for i, stream := range c.Streams {
+		key := fmt.Sprintf("streams[%d]", i)
+		checkRegex(key+".player", i, stream.Player)
+		for j, expression := range stream.Patterns {
+			pattern, err := regexp.Compile(expression)
+			if err != nil {
+				checkRegex(fmt.Sprintf("%s.patterns[%d]", key, j), i, expression)
+			} else if pattern.SubexpIndex("artist") < 0 || pattern.SubexpIndex("track") < 0 {
+				add(fmt.Sprintf("%s.patterns[%d]", key, j), i,
+					"regular expression %q must contain the named groups artist and track", expression)
+			}
+		}
+		for j, expression := range stream.Ignore {
+			checkRegex(fmt.Sprintf("%s.ignore[%d]", key, j), i, expression)
+		}
+		if stream.ListenThreshold < 0 {
+			add(key+".listen_threshold", i, "must not be negative (got %d)", stream.ListenThreshold)
+		}
+	}
+	for i, expression := range c.Deduplication.SourcePriority {
+		checkRegex(fmt.Sprintf("deduplication.source_priority[%d]", i), 0, expression)
+	}
+	for i, expression := range c.ContentFilter.Genres {
+		checkRegex(fmt.Sprintf("content_filter.genres[%d]", i), 0, expression)
+	}
+	for i, expression := range c.ContentFilter.TrackIDs {
+		checkRegex(fmt.Sprintf("content_filter.track_ids[%d]", i), 0, expression)
+	}
+
+	for i, field := range c.MusicBrainz.Fields {
+		if !slices.Contains(MusicBrainzFields, field) {
+			add(fmt.Sprintf("musicbrainz.fields[%d]", i), 0,
+				"unknown field %q (must be one of %s)", field, strings.Join(MusicBrainzFields, ", "))
+		}
+	}
+	if score := c.MusicBrainz.MinScore; score < 0 || score > 100 {
+		add("musicbrainz.min_score", 0, "must be between 0 and 100 (got %d)", score)
+	}
+	if baseURL := c.MusicBrainz.BaseURL; baseURL != "" {
+		if parsed, err := url.Parse(baseURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			add("musicbrainz.base_url", 0, "invalid URL %q", baseURL)
+		}
+	}
+
+	contentFilter := c.ContentFilter
+	if contentFilter.MinDuration < 0 {
+		add("content_filter.min_duration", 0, "must not be negative (got %d)", contentFilter.MinDuration)
+	}
+	if contentFilter.MaxDuration < 0 {
+		add("content_filter.max_duration", 0, "must not be negative (got %d)", contentFilter.MaxDuration)
+	} else if contentFilter.MaxDuration > 0 && contentFilter.MaxDuration < contentFilter.MinDuration {
+		add("content_filter.max_duration", 0, "must not be smaller than min_duration (got %d)", contentFilter.MaxDuration)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.HTTP)) {
+		httpConfig := c.Sources.HTTP[key]
+		httpKey := "sources.http." + key
+		if httpConfig.URL == "" {
+			add(httpKey, 0, "URL is required")
+		}
+		if _, err := DurationUnit(httpConfig.Fields.DurationUnit); err != nil {
+			add(httpKey+".fields.duration_unit", 0, "%s", err.Error())
+		}
+		if _, err := DurationUnit(httpConfig.Fields.PositionUnit); err != nil {
+			add(httpKey+".fields.position_unit", 0, "%s", err.Error())
+		}
+	}
+
+	if proxyConfig := c.Sources.LastFmProxy; proxyConfig != nil {
+		if proxyConfig.Key == "" || proxyConfig.Secret == "" || len(proxyConfig.Users) == 0 {
+			add("sources.lastfm-proxy", 0, "API key, secret, and at least one user are required")
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.Jellyfin)) {
+		jellyfinConfig := c.Sources.Jellyfin[key]
+		if jellyfinConfig.URL == "" || jellyfinConfig.APIKey == "" {
+			add("sources.jellyfin."+key, 0, "URL and API key are required")
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(c.Sources.Subsonic)) {
+		subsonicConfig := c.Sources.Subsonic[key]
+		if subsonicConfig.URL == "" || (subsonicConfig.APIKey == "" && subsonicConfig.Username == "") {
+			add("sources.subsonic."+key, 0, "URL and API key or username/password are required")
+		}
+	}
+
+	return errs
+}
+
+// KeyLines maps dotted keys and table names of a TOML file to the lines they are defined on. Keys of arrays of
+// tables (e.g., `[[regexes]]`) are stored once per table.
+type KeyLines map[string][]int
+
+// ConfigKeyLines finds the line numbers of keys in a TOML file. It only handles the subset of TOML used by config
+// files (no multi-line strings containing `=` or brackets at the start of a line).
+func ConfigKeyLines(data []byte) KeyLines {
+	lines := KeyLines{}
+
+	var table []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "["):
+			header, _, _ := strings.Cut(line, "#")
+			header = strings.Trim(strings.TrimSpace(header), "[]")
+			table = splitTOMLKey(header)
+			lines.add(table, i+1)
+		default:
+			key, _, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			lines.add(append(slices.Clone(table), splitTOMLKey(key)...), i+1)
+		}
+	}
+
+	return lines
+}
+
+func (l KeyLines) add(key []string, line int) {
+	joined := strings.Join(key, ".")
+	l[joined] = append(l[joined], line)
+}
+
+// Line returns the line of the nth definition of a key (or its closest parent), ignoring array indices. It
+// returns 0 if the key is not defined.
+func (l KeyLines) Line(key string, occurrence int) int {
+	key = arrayIndexRegex.ReplaceAllString(key, "")
+
+	for {
+		if lines, ok := l[key]; ok {
+			return lines[min(occurrence, len(lines)-1)]
+		}
+
+		index := strings.LastIndex(key, ".")
+		if index < 0 {
+			return 0
+		}
+		key = key[:index]
+	}
+}
+
+var arrayIndexRegex = regexp.MustCompile(`\[\d+\]`)
+
+func splitTOMLKey(key string) []string {
+	var parts []string
+	for part := range strings.SplitSeq(key, ".") {
+		parts = append(parts, strings.Trim(strings.TrimSpace(part), `"'`))
+	}
+	return parts
+}
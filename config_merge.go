@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfigFile is a decoded config file. Meta and Data are used to merge files and to look up line numbers.
+type ConfigFile struct {
+	Filename string
+	Config   Config
+	Meta     toml.MetaData
+	Data     []byte
+}
+
+// ReadConfigFiles reads a config file and all files it includes, in the order they are merged: included files
+// (recursively, in the order of the `include` list) come before the file including them. If the config file does
+// not exist, the default config is written.
+func ReadConfigFiles(filename string) ([]ConfigFile, error) {
+	log.Debug().Msg("creating config directory")
+	directory := filepath.Dir(filename)
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		log.Info().
+			Str("filename", filename).
+			Msg("creating default configuration file")
+		if err := DefaultConfig.Write(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	return readConfigFiles(filename, []string{})
+}
+
+func readConfigFiles(filename string, including []string) ([]ConfigFile, error) {
+	absolute, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(including, absolute) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(including, absolute), " -> "))
+	}
+	including = append(slices.Clone(including), absolute)
+
+	log.Debug().
+		Str("filename", filename).
+		Msg("reading config")
+
+	//nolint:gosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	meta, err := toml.Decode(string(data), &config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	var files []ConfigFile
+	for _, pattern := range config.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include pattern: %w", filename, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("%s: included file %s does not exist", filename, pattern)
+		}
+
+		for _, match := range matches {
+			included, err := readConfigFiles(match, including)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, included...)
+		}
+	}
+
+	return append(files, ConfigFile{Filename: filename, Config: config, Meta: meta, Data: data}), nil
+}
+
+// MergeConfigFiles merges config files in order, then the sections of the profile (if set) of all files.
+//
+// Values defined in later files replace earlier ones, except for lists (e.g., `blacklist`, `regexes`), which are
+// appended. Sources and sinks are merged by key, so a later file can add sinks or replace a sink with the same key
+// entirely.
+func MergeConfigFiles(files []ConfigFile, profile string) (Config, error) {
+	var config Config
+
+	for _, file := range files {
+		mergeConfig(&config, file.Config, file.Meta, []string{})
+	}
+
+	if profile == "" {
+		return config, nil
+	}
+
+	found := false
+	for _, file := range files {
+		profileConfig, ok := file.Config.Profiles[profile]
+		if !ok {
+			continue
+		}
+
+		log.Debug().
+			Str("filename", file.Filename).
+			Str("profile", profile).
+			Msg("applying profile")
+
+		mergeConfig(&config, profileConfig, file.Meta, []string{"profiles", profile})
+		found = true
+	}
+
+	if !found {
+		return Config{}, fmt.Errorf("profile %q is not defined", profile)
+	}
+	return config, nil
+}
+
+func mergeConfig(dst *Config, src Config, meta toml.MetaData, key []string) {
+	mergeValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src), meta, key)
+}
+
+// mergeValue merges src into dst, skipping struct fields not defined in the config file. It does not modify maps
+// or slices of dst, since they may be shared with [DefaultConfig].
+func mergeValue(dst, src reflect.Value, meta toml.MetaData, key []string) {
+	kind := dst.Kind()
+
+	switch {
+	case kind == reflect.Struct:
+		for i := range dst.NumField() {
+			name, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("toml"), ",")
+			if name == "" || name == "include" || name == "profiles" {
+				continue
+			}
+
+			fieldKey := append(slices.Clone(key), name)
+			if meta.IsDefined(fieldKey...) {
+				mergeValue(dst.Field(i), src.Field(i), meta, fieldKey)
+			}
+		}
+	case kind == reflect.Slice:
+		merged := reflect.MakeSlice(dst.Type(), 0, dst.Len()+src.Len())
+		merged = reflect.AppendSlice(merged, dst)
+		merged = reflect.AppendSlice(merged, src)
+		dst.Set(merged)
+	case kind == reflect.Map:
+		merged := reflect.MakeMap(dst.Type())
+		for _, m := range []reflect.Value{dst, src} {
+			iter := m.MapRange()
+			for iter.Next() {
+				merged.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		dst.Set(merged)
+	default:
+		dst.Set(src)
+	}
+}
+
+// CheckConfigFiles runs [Config.Check] for all config files and their profiles.
+func CheckConfigFiles(files []ConfigFile) ConfigErrors {
+	var errs ConfigErrors
+
+	for i, file := range files {
+		fileErrs := file.Config.Check(file.Meta, file.Data)
+
+		// errors in the main config file (the last one) are reported without filename
+		if i < len(files)-1 {
+			for j := range fileErrs {
+				fileErrs[j].File = file.Filename
+			}
+		}
+		errs = append(errs, fileErrs...)
+	}
+
+	return errs
+}
@@ -0,0 +1,111 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+const sharedConfig = `blacklist = ["chromium"]
+poll_rate = 5
+
+[[regexes]]
+match = " - Remastered$"
+replace = ""
+track = true
+
+[sinks.csv.shared]
+filename = "/tmp/shared.csv"
+
+[sinks.csv.default]
+filename = "/tmp/replaced.csv"
+`
+
+const mainConfig = `include = ["shared.toml", "conf.d/*.toml"]
+min_playback_duration = 300
+
+[sinks.csv.default]
+filename = "/tmp/default.csv"
+
+[profiles.work]
+poll_rate = 10
+blacklist = ["spotify"]
+
+[profiles.work.sinks.csv.default]
+filename = "/tmp/work.csv"
+`
+
+func writeIncludeConfigs(t *testing.T) string {
+	t.Helper()
+
+	directory := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(directory, "conf.d"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(directory, "shared.toml"), []byte(sharedConfig), 0600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(directory, "conf.d", "10-laptop.toml"),
+		[]byte(`blacklist = ["firefox"]`),
+		0600,
+	))
+
+	filename := filepath.Join(directory, main.DefaultConfigFileName)
+	require.NoError(t, os.WriteFile(filename, []byte(mainConfig), 0600))
+
+	return filename
+}
+
+func TestReadConfigInclude(t *testing.T) {
+	filename := writeIncludeConfigs(t)
+
+	files, err := main.ReadConfigFiles(filename)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.Equal(t, filename, files[2].Filename)
+
+	config, err := main.ReadConfig(filename)
+	require.NoError(t, err)
+	require.Equal(t, 5, config.PollRate)
+	require.Equal(t, 300, config.MinPlaybackDuration)
+	require.Equal(t, []string{"chromium", "firefox"}, config.Blacklist)
+	require.Len(t, config.Regexes, 1)
+	require.Equal(t, map[string]main.CSVConfig{
+		"shared":  {Filename: "/tmp/shared.csv"},
+		"default": {Filename: "/tmp/default.csv"},
+	}, config.Sinks.CSV)
+	require.Empty(t, config.Sinks.LastFm)
+}
+
+func TestReadConfigProfile(t *testing.T) {
+	filename := writeIncludeConfigs(t)
+
+	config, err := main.LoadConfig(filename, main.ConfigOptions{Strict: true, Profile: "work"})
+	require.NoError(t, err)
+	require.Equal(t, 10, config.PollRate)
+	require.Equal(t, []string{"chromium", "firefox", "spotify"}, config.Blacklist)
+	require.Equal(t, "/tmp/work.csv", config.Sinks.CSV["default"].Filename)
+	require.Equal(t, "/tmp/shared.csv", config.Sinks.CSV["shared"].Filename)
+
+	_, err = main.LoadConfig(filename, main.ConfigOptions{Strict: false, Profile: "missing"})
+	require.EqualError(t, err, `profile "missing" is not defined`)
+}
+
+func TestReadConfigIncludeErrors(t *testing.T) {
+	directory := t.TempDir()
+	filename := filepath.Join(directory, main.DefaultConfigFileName)
+
+	require.NoError(t, os.WriteFile(filename, []byte(`include = ["missing.toml"]`), 0600))
+	_, err := main.ReadConfig(filename)
+	require.ErrorContains(t, err, "does not exist")
+
+	require.NoError(t, os.WriteFile(filename, []byte(`include = ["*.toml"]`), 0600))
+	_, err = main.ReadConfig(filename)
+	require.ErrorContains(t, err, "include cycle")
+
+	shared := filepath.Join(directory, "shared.toml")
+	require.NoError(t, os.WriteFile(shared, []byte("poll_rte = 2\n"), 0600))
+	require.NoError(t, os.WriteFile(filename, []byte(`include = ["shared.toml"]`), 0600))
+	_, err = main.LoadConfig(filename, main.ConfigOptions{Strict: true, Profile: ""})
+	require.ErrorContains(t, err, shared+", line 1: poll_rte: unknown key")
+}
@@ -46,6 +46,66 @@ func TestReadConfig(t *testing.T) {
 	})
 }
 
+const invalidConfig = `poll_rate = 2
+min_playback_precent = 50
+min_playback_duration = 9999
+blacklist = ["org.mpris.MediaPlayer2.firefox", "(broken"]
+
+[[regexes]]
+match = " - Remastered$"
+
+[[regexes]]
+match = "[a-"
+
+[sources.http.radio]
+fields.duration_unit = "weeks"
+`
+
+func TestReadConfigStrict(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), main.DefaultConfigFileName)
+
+	_, err := main.LoadConfig(filename, main.ConfigOptions{Strict: true, Profile: ""})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filename, []byte(invalidConfig), 0600))
+
+	_, err = main.LoadConfig(filename, main.ConfigOptions{Strict: true, Profile: ""})
+	var errs main.ConfigErrors
+	require.ErrorAs(t, err, &errs)
+	require.Equal(t, []string{
+		"line 2: min_playback_precent: unknown key",
+		"line 3: min_playback_duration: must be between 1 and 1200 (got 9999)",
+		"line 4: blacklist[1]: invalid regular expression \"(broken\": " +
+			"error parsing regexp: missing closing ): `(broken`",
+		"line 10: regexes[1].match: invalid regular expression \"[a-\": " +
+			"error parsing regexp: missing closing ]: `[a-`",
+		"line 12: sources.http.radio: URL is required",
+		"line 13: sources.http.radio.fields.duration_unit: invalid duration unit \"weeks\" (must be s, ms, us, or ns)",
+	}, errorStrings(errs))
+
+	config, err := main.ReadConfig(filename)
+	require.NoError(t, err)
+	require.Equal(t, 4*60, config.MinPlaybackDuration)
+}
+
+func errorStrings(errs main.ConfigErrors) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+func TestConfigKeyLines(t *testing.T) {
+	lines := main.ConfigKeyLines([]byte(invalidConfig))
+	require.Equal(t, 1, lines.Line("poll_rate", 0))
+	require.Equal(t, 7, lines.Line("regexes[0].match", 0))
+	require.Equal(t, 10, lines.Line("regexes[1].match", 1))
+	require.Equal(t, 13, lines.Line("sources.http.radio.fields.duration_unit", 0))
+	require.Equal(t, 12, lines.Line("sources.http.radio.url", 0))
+	require.Equal(t, 0, lines.Line("sinks", 0))
+}
+
 func TestConfigValidate(t *testing.T) {
 	//nolint:exhaustruct
 	invalidConfig := main.Config{
@@ -92,3 +152,43 @@ func TestConfigDir(t *testing.T) {
 		require.Equal(t, "/home/user/.config/goscrobble", configDir)
 	})
 }
+
+func TestStateDir(t *testing.T) {
+	t.Run("$XDG_STATE_HOME", func(t *testing.T) {
+		t.Setenv("HOME", "/home/user")
+		t.Setenv("XDG_STATE_HOME", "/home/user/my-state-dir")
+		stateDir := main.StateDir()
+		require.Equal(t, "/home/user/my-state-dir/goscrobble", stateDir)
+	})
+	t.Run("$HOME", func(t *testing.T) {
+		t.Setenv("HOME", "/home/user")
+		t.Setenv("XDG_STATE_HOME", "")
+		stateDir := main.StateDir()
+		require.Equal(t, "/home/user/.local/state/goscrobble", stateDir)
+	})
+}
+
+func TestSinkSetups(t *testing.T) {
+	config := main.DefaultConfig
+	config.Sinks.LastFm = map[string]main.LastFmConfig{}
+	config.Sinks.CSV = map[string]main.CSVConfig{
+		"network": {Filename: "/mnt/scrobbles.csv"},
+		"default": {Filename: "scrobbles.csv"},
+	}
+	config.Sinks.LastFm["default"] = main.LastFmConfig{
+		BaseURL:    "",
+		Key:        fakeLastFmKey,
+		Secret:     fakeLastFmSecret,
+		SessionKey: "",
+		Username:   "",
+	}
+
+	setups := config.SinkSetups()
+	require.Len(t, setups, 3)
+	require.Equal(t, "lastfm.default", setups[0].Key)
+	require.ErrorContains(t, setups[0].Error, "not authenticated")
+	require.Equal(t, "csv.default", setups[1].Key)
+	require.Equal(t, "csv.network", setups[2].Key)
+
+	require.Len(t, config.SetupSinks(), 2)
+}
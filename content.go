@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ContentFilter skips tracks that are not music (e.g., videos, podcasts, and audiobooks) using metadata reported by
+// the player and the track length.
+type ContentFilter struct {
+	Genres      []*regexp.Regexp
+	URLSchemes  []string
+	URLHosts    []string
+	TrackIDs    []*regexp.Regexp
+	MinDuration time.Duration
+	MaxDuration time.Duration
+}
+
+// NewContentFilter returns nil if content filtering is disabled.
+func NewContentFilter(c ContentFilterConfig) *ContentFilter {
+	if !c.Enabled {
+		return nil
+	}
+
+	compile := func(key string, expressions []string) []*regexp.Regexp {
+		var compiled []*regexp.Regexp
+		for _, expression := range expressions {
+			re, err := regexp.Compile(expression)
+			if err != nil {
+				log.Warn().
+					Str("key", key).
+					Str("expression", expression).
+					Err(err).
+					Msg("failed to compile content filter entry")
+				continue
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled
+	}
+
+	return &ContentFilter{
+		Genres:      compile("genres", c.Genres),
+		URLSchemes:  c.URLSchemes,
+		URLHosts:    c.URLHosts,
+		TrackIDs:    compile("track_ids", c.TrackIDs),
+		MinDuration: time.Duration(c.MinDuration) * time.Second,
+		MaxDuration: time.Duration(c.MaxDuration) * time.Second,
+	}
+}
+
+// Match checks if a track should be skipped and returns the reason. It always returns false if f is nil. Tracks
+// without a duration are not checked against the duration bounds.
+func (f *ContentFilter) Match(status PlaybackStatus) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+
+	for _, genre := range status.Metadata.Genres {
+		for _, re := range f.Genres {
+			if re.MatchString(genre) {
+				return fmt.Sprintf("genre %q matches %q", genre, re.String()), true
+			}
+		}
+	}
+
+	if status.Metadata.URL != "" {
+		parsed, err := url.Parse(status.Metadata.URL)
+		if err == nil {
+			if slices.ContainsFunc(f.URLSchemes, func(scheme string) bool {
+				return strings.EqualFold(scheme, parsed.Scheme)
+			}) {
+				return fmt.Sprintf("URL scheme %q is filtered", parsed.Scheme), true
+			}
+			if slices.ContainsFunc(f.URLHosts, func(host string) bool {
+				return strings.EqualFold(host, parsed.Hostname())
+			}) {
+				return fmt.Sprintf("URL host %q is filtered", parsed.Hostname()), true
+			}
+		}
+	}
+
+	if status.Metadata.TrackID != "" {
+		for _, re := range f.TrackIDs {
+			if re.MatchString(status.Metadata.TrackID) {
+				return fmt.Sprintf("track ID %q matches %q", status.Metadata.TrackID, re.String()), true
+			}
+		}
+	}
+
+	switch {
+	case status.Duration == 0:
+		return "", false
+	case f.MinDuration > 0 && status.Duration < f.MinDuration:
+		return fmt.Sprintf("duration %s is shorter than %s", status.Duration, f.MinDuration), true
+	case f.MaxDuration > 0 && status.Duration > f.MaxDuration:
+		return fmt.Sprintf("duration %s is longer than %s", status.Duration, f.MaxDuration), true
+	default:
+		return "", false
+	}
+}
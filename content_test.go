@@ -0,0 +1,93 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentFilter(t *testing.T) {
+	require.Nil(t, main.NewContentFilter(main.ContentFilterConfig{
+		Enabled:     false,
+		Genres:      []string{},
+		URLSchemes:  []string{},
+		URLHosts:    []string{},
+		TrackIDs:    []string{},
+		MinDuration: 0,
+		MaxDuration: 0,
+	}))
+
+	config := main.DefaultConfig.ContentFilter
+	config.Genres = append(config.Genres, "[")
+	config.URLSchemes = []string{"file"}
+	config.TrackIDs = []string{"^/org/chromium/"}
+	config.MinDuration = 30
+	config.MaxDuration = 60 * 60
+	filter := main.NewContentFilter(config)
+	require.Len(t, filter.Genres, len(main.DefaultConfig.ContentFilter.Genres))
+
+	match := func(update func(status *main.PlaybackStatus)) bool {
+		status := defaultPlaybackStatus
+		update(&status)
+		_, ok := filter.Match(status)
+		return ok
+	}
+
+	require.False(t, match(func(_ *main.PlaybackStatus) {}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Metadata.Genres = []string{"Rock", "Podcast"}
+	}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Metadata.URL = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	}))
+	require.False(t, match(func(status *main.PlaybackStatus) {
+		status.Metadata.URL = "https://music.youtube.com/watch?v=dQw4w9WgXcQ"
+	}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Metadata.URL = "file:///home/user/Videos/concert.mkv"
+	}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Metadata.TrackID = "/org/chromium/MediaPlayer2/TrackList/Track1"
+	}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Duration = 3 * time.Hour
+	}))
+	require.True(t, match(func(status *main.PlaybackStatus) {
+		status.Duration = 10 * time.Second
+	}))
+	require.False(t, match(func(status *main.PlaybackStatus) {
+		status.Duration = 0
+	}))
+
+	var nilFilter *main.ContentFilter
+	_, ok := nilFilter.Match(defaultPlaybackStatus)
+	require.False(t, ok)
+}
+
+func TestMainLoopContentFilter(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource.PlaybackStatus.Position = 0
+	fakeSource.PlaybackStatus.Metadata.URL = "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	fakeSink := &FakeSink{}
+
+	loop := main.NewMainLoop(main.DefaultConfig, []main.Source{fakeSource}, []main.Sink{fakeSink}, nil)
+	loop.RunOnce()
+	require.Empty(t, fakeSink.NowPlayingLog)
+	require.Contains(t, loop.Skipped, "fake player")
+
+	fakeSource.PlaybackStatus.Position = 4 * time.Minute
+	loop.RunOnce()
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	fakeSource.PlaybackStatus.Metadata.URL = "https://music.youtube.com/watch?v=dQw4w9WgXcQ"
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Empty(t, loop.Skipped)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+const CorrectionsFileName = "corrections.json"
+
+// Corrections stores artist, track, and album names corrected by last.fm, so later scrobbles (including those
+// written to other sinks) use the same names.
+type Corrections struct {
+	Filename string
+	Entries  []Correction
+}
+
+type Correction struct {
+	Original  CorrectionTrack `json:"original"`
+	Corrected CorrectionTrack `json:"corrected"`
+}
+
+type CorrectionTrack struct {
+	Artists []string `json:"artists"`
+	Track   string   `json:"track"`
+	Album   string   `json:"album"`
+}
+
+func CorrectionTrackFromScrobble(scrobble Scrobble) CorrectionTrack {
+	return CorrectionTrack{Artists: scrobble.Artists, Track: scrobble.Track, Album: scrobble.Album}
+}
+
+func (t CorrectionTrack) Matches(scrobble Scrobble) bool {
+	return slices.Equal(t.Artists, scrobble.Artists) && t.Track == scrobble.Track && t.Album == scrobble.Album
+}
+
+func CorrectionsFilename() string {
+	return filepath.Join(StateDir(), CorrectionsFileName)
+}
+
+// LoadCorrections reads the corrections file. A missing file is not an error.
+func LoadCorrections(filename string) (*Corrections, error) {
+	corrections := &Corrections{Filename: filename, Entries: []Correction{}}
+
+	//nolint:gosec
+	data, err := os.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+		return corrections, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &corrections.Entries); err != nil {
+		return nil, err
+	}
+
+	log.Debug().
+		Str("filename", filename).
+		Int("corrections", len(corrections.Entries)).
+		Msg("loaded corrections")
+
+	return corrections, nil
+}
+
+// Apply replaces the metadata of the scrobble if a matching correction exists. It is a no-op if c is nil.
+func (c *Corrections) Apply(scrobble *Scrobble) bool {
+	if c == nil {
+		return false
+	}
+
+	for _, correction := range c.Entries {
+		if correction.Original.Matches(*scrobble) {
+			scrobble.Artists = correction.Corrected.Artists
+			scrobble.Track = correction.Corrected.Track
+			scrobble.Album = correction.Corrected.Album
+			return true
+		}
+	}
+	return false
+}
+
+// Learn stores a new correction and writes the corrections file. It is a no-op if c is nil.
+func (c *Corrections) Learn(original, corrected Scrobble) error {
+	if c == nil || CorrectionTrackFromScrobble(corrected).Matches(original) {
+		return nil
+	}
+
+	entry := Correction{
+		Original:  CorrectionTrackFromScrobble(original),
+		Corrected: CorrectionTrackFromScrobble(corrected),
+	}
+
+	index := slices.IndexFunc(c.Entries, func(existing Correction) bool {
+		return existing.Original.Matches(original)
+	})
+	if index >= 0 {
+		c.Entries[index] = entry
+	} else {
+		c.Entries = append(c.Entries, entry)
+	}
+
+	log.Info().
+		Interface("original", entry.Original).
+		Interface("corrected", entry.Corrected).
+		Msg("learned correction")
+
+	return c.Write()
+}
+
+func (c *Corrections) Write() error {
+	if err := os.MkdirAll(filepath.Dir(c.Filename), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c.Entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(c.Filename, data, 0600)
+}
@@ -0,0 +1,37 @@
+package main_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrections(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", main.CorrectionsFileName)
+
+	corrections, err := main.LoadCorrections(filename)
+	require.NoError(t, err)
+	require.Empty(t, corrections.Entries)
+
+	original := defaultScrobble
+	original.Artists = []string{"placebo"}
+
+	require.NoError(t, corrections.Learn(original, defaultScrobble))
+	require.NoError(t, corrections.Learn(defaultScrobble, defaultScrobble))
+	require.Len(t, corrections.Entries, 1)
+
+	corrections, err = main.LoadCorrections(filename)
+	require.NoError(t, err)
+	require.Len(t, corrections.Entries, 1)
+
+	scrobble := original
+	require.True(t, corrections.Apply(&scrobble))
+	require.Equal(t, defaultScrobble, scrobble)
+	require.False(t, corrections.Apply(&scrobble))
+
+	var disabled *main.Corrections
+	require.False(t, disabled.Apply(&scrobble))
+	require.NoError(t, disabled.Learn(original, defaultScrobble))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+const CredentialsFileName = "credentials.toml"
+
+// Credentials stores secrets obtained by goscrobble (e.g., by `goscrobble lastfm-auth`) in a separate file, so the
+// config file is never rewritten.
+type Credentials struct {
+	LastFm map[string]LastFmCredentials `toml:"lastfm"`
+}
+
+type LastFmCredentials struct {
+	SessionKey string `toml:"session_key"`
+	Username   string `toml:"username"`
+}
+
+// CredentialsFilename returns the path of the credentials file, which is stored next to the config file.
+func CredentialsFilename(configFilename string) string {
+	return filepath.Join(filepath.Dir(configFilename), CredentialsFileName)
+}
+
+// ReadCredentials returns empty credentials if the file does not exist.
+func ReadCredentials(filename string) (Credentials, error) {
+	credentials := Credentials{LastFm: map[string]LastFmCredentials{}}
+
+	_, err := toml.DecodeFile(filename, &credentials)
+	if err != nil && !os.IsNotExist(err) {
+		return Credentials{}, err
+	}
+
+	if credentials.LastFm == nil {
+		credentials.LastFm = map[string]LastFmCredentials{}
+	}
+
+	return credentials, nil
+}
+
+// Apply sets the session key and username of last.fm sinks that are not authenticated in the config file.
+func (c Credentials) Apply(config *Config) {
+	if len(c.LastFm) == 0 {
+		return
+	}
+
+	// the map may be shared with DefaultConfig
+	config.Sinks.LastFm = maps.Clone(config.Sinks.LastFm)
+
+	for key, credentials := range c.LastFm {
+		lastFmConfig, ok := config.Sinks.LastFm[key]
+		if !ok {
+			log.Warn().
+				Str("key", key).
+				Msg("found credentials for last.fm sink that is not configured")
+			continue
+		}
+
+		if lastFmConfig.SessionKey == "" && lastFmConfig.Username == "" {
+			lastFmConfig.SessionKey = credentials.SessionKey
+			lastFmConfig.Username = credentials.Username
+			config.Sinks.LastFm[key] = lastFmConfig
+		}
+	}
+}
+
+func (c Credentials) Write(filename string) error {
+	log.Debug().
+		Str("filename", filename).
+		Msg("writing credentials file")
+
+	var buffer bytes.Buffer
+	if err := toml.NewEncoder(&buffer).Encode(c); err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(filename, buffer.Bytes(), 0600)
+}
+
+// WriteFileAtomic writes data to a temporary file in the same directory and renames it, so the file is never
+// truncated or partially written.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// no-op if the file was renamed
+		_ = os.Remove(temp.Name())
+	}()
+
+	if err := temp.Chmod(perm); err != nil {
+		CloseLogged(temp)
+		return err
+	}
+	if _, err := temp.Write(data); err != nil {
+		CloseLogged(temp)
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		CloseLogged(temp)
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), filename)
+}
@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentials(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), main.CredentialsFileName)
+
+	credentials, err := main.ReadCredentials(filename)
+	require.NoError(t, err)
+	require.Empty(t, credentials.LastFm)
+
+	credentials.LastFm["default"] = main.LastFmCredentials{SessionKey: "session key", Username: "username"}
+	require.NoError(t, credentials.Write(filename))
+
+	stat, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	read, err := main.ReadCredentials(filename)
+	require.NoError(t, err)
+	require.Equal(t, credentials, read)
+}
+
+func TestReadConfigCredentials(t *testing.T) {
+	configFilename := filepath.Join(t.TempDir(), main.DefaultConfigFileName)
+	require.NoError(t, main.DefaultConfig.Write(configFilename))
+
+	original, err := os.ReadFile(configFilename)
+	require.NoError(t, err)
+
+	credentials := main.Credentials{LastFm: map[string]main.LastFmCredentials{
+		"default": {SessionKey: "session key", Username: "username"},
+		"missing": {SessionKey: "other session key", Username: "other username"},
+	}}
+	require.NoError(t, credentials.Write(main.CredentialsFilename(configFilename)))
+
+	config, err := main.ReadConfig(configFilename)
+	require.NoError(t, err)
+	require.Equal(t, "session key", config.Sinks.LastFm["default"].SessionKey)
+	require.Equal(t, "username", config.Sinks.LastFm["default"].Username)
+	require.NotContains(t, config.Sinks.LastFm, "missing")
+	require.Empty(t, main.DefaultConfig.Sinks.LastFm["default"].SessionKey)
+
+	unchanged, err := os.ReadFile(configFilename)
+	require.NoError(t, err)
+	require.Equal(t, original, unchanged)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "file")
+
+	require.NoError(t, os.WriteFile(filename, []byte("old"), 0644))
+	require.NoError(t, main.WriteFileAtomic(filename, []byte("new"), 0600))
+
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(data))
+
+	stat, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	entries, err := os.ReadDir(directory)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeduplicationMaxAge is the time after which scrobbles are no longer considered for deduplication.
+const DeduplicationMaxAge = 24 * time.Hour
+
+// Deduplicator prevents double scrobbles if multiple players report the same playback (e.g., an app exposing
+// an MPRIS player and a JSON API at the same time).
+type Deduplicator struct {
+	Window         time.Duration
+	SourcePriority []*regexp.Regexp
+	Recent         []QueuedScrobble
+}
+
+// NewDeduplicator returns nil if deduplication is disabled.
+func NewDeduplicator(c DeduplicationConfig) *Deduplicator {
+	if !c.Enabled {
+		return nil
+	}
+
+	var sourcePriority []*regexp.Regexp
+	for _, expression := range c.SourcePriority {
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			log.Warn().
+				Str("expression", expression).
+				Err(err).
+				Msg("failed to compile source priority entry")
+			continue
+		}
+		sourcePriority = append(sourcePriority, compiled)
+	}
+
+	return &Deduplicator{
+		Window:         time.Duration(c.Window) * time.Second,
+		SourcePriority: sourcePriority,
+		Recent:         []QueuedScrobble{},
+	}
+}
+
+// Priority returns the index of the first source priority entry matching the player (lower is better). Players
+// without a matching entry have the lowest priority.
+func (d *Deduplicator) Priority(player string) int {
+	index := slices.IndexFunc(d.SourcePriority, func(expression *regexp.Regexp) bool {
+		return expression.MatchString(player)
+	})
+	if index < 0 {
+		return len(d.SourcePriority)
+	}
+	return index
+}
+
+// IsDuplicate checks if another player already scrobbled the same track. It returns the name of the other player.
+// It always returns false if d is nil.
+func (d *Deduplicator) IsDuplicate(player string, scrobble Scrobble) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	for _, recent := range d.Recent {
+		if recent.Player != player && d.isSamePlayback(recent.Scrobble, scrobble) {
+			return recent.Player, true
+		}
+	}
+
+	return "", false
+}
+
+// PreferredPlayer checks if another player with a higher priority is currently playing the same track, so the
+// scrobble should be retried later (it is dropped by IsDuplicate once the other player scrobbled it). Paused and
+// stopped players are ignored. It always returns false if d is nil.
+func (d *Deduplicator) PreferredPlayer(
+	player string,
+	scrobble Scrobble,
+	playing map[string]PlaybackStatus,
+) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	priority := d.Priority(player)
+	for other, status := range playing {
+		if other != player && status.State == PlaybackPlaying && d.Priority(other) < priority &&
+			d.isSamePlayback(status.Scrobble, scrobble) {
+			return other, true
+		}
+	}
+
+	return "", false
+}
+
+// Add remembers a scrobble sent for a player. It is a no-op if d is nil.
+func (d *Deduplicator) Add(player string, scrobble Scrobble) {
+	if d == nil {
+		return
+	}
+
+	d.Recent = slices.DeleteFunc(d.Recent, func(recent QueuedScrobble) bool {
+		return time.Since(recent.Scrobble.Timestamp) > DeduplicationMaxAge
+	})
+	d.Recent = append(d.Recent, QueuedScrobble{Player: player, Scrobble: scrobble, Original: scrobble})
+}
+
+func (d *Deduplicator) isSamePlayback(a, b Scrobble) bool {
+	difference := a.Timestamp.Sub(b.Timestamp).Abs()
+	return difference <= d.Window && IsSameTrack(a, b)
+}
+
+// IsSameTrack compares the track names and checks if at least one artist matches (ignoring case), since sources
+// report multiple artists differently.
+func IsSameTrack(a, b Scrobble) bool {
+	if !strings.EqualFold(strings.TrimSpace(a.Track), strings.TrimSpace(b.Track)) {
+		return false
+	}
+
+	for _, artist := range a.Artists {
+		if slices.ContainsFunc(b.Artists, func(other string) bool {
+			return strings.EqualFold(strings.TrimSpace(artist), strings.TrimSpace(other))
+		}) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSameTrack(t *testing.T) {
+	other := defaultScrobble
+	other.Artists = []string{"placebo "}
+	other.Track = "WITHOUT YOU I'M NOTHING"
+	require.True(t, main.IsSameTrack(defaultScrobble, other))
+
+	other.Artists = []string{"David Bowie"}
+	require.True(t, main.IsSameTrack(defaultScrobble, other))
+
+	other.Artists = []string{"Brian Molko"}
+	require.False(t, main.IsSameTrack(defaultScrobble, other))
+
+	other = defaultScrobble
+	other.Track = "Pure Morning"
+	require.False(t, main.IsSameTrack(defaultScrobble, other))
+}
+
+func TestDeduplicator(t *testing.T) {
+	require.Nil(t, main.NewDeduplicator(main.DeduplicationConfig{
+		Enabled:        false,
+		Window:         30,
+		SourcePriority: []string{},
+	}))
+
+	deduplicator := main.NewDeduplicator(main.DeduplicationConfig{
+		Enabled:        true,
+		Window:         30,
+		SourcePriority: []string{"[", "^tidal-hifi:", "^dbus:"},
+	})
+	require.Len(t, deduplicator.SourcePriority, 2)
+
+	require.Equal(t, 0, deduplicator.Priority("tidal-hifi:http://localhost:47836/current"))
+	require.Equal(t, 1, deduplicator.Priority("dbus:org.mpris.MediaPlayer2.tidal-hifi"))
+	require.Equal(t, 2, deduplicator.Priority("webhook:kitchen"))
+
+	scrobble := defaultScrobble
+	scrobble.Timestamp = time.Now()
+
+	playing := map[string]main.PlaybackStatus{
+		"tidal-hifi:http://localhost:47836/current": {
+			Scrobble: scrobble,
+			State:    main.PlaybackPlaying,
+			Position: 0,
+			Metadata: main.PlayerMetadata{},
+		},
+	}
+
+	other, ok := deduplicator.PreferredPlayer("dbus:org.mpris.MediaPlayer2.tidal-hifi", scrobble, playing)
+	require.True(t, ok)
+	require.Equal(t, "tidal-hifi:http://localhost:47836/current", other)
+
+	_, ok = deduplicator.PreferredPlayer("tidal-hifi:http://localhost:47836/current", scrobble, playing)
+	require.False(t, ok)
+
+	// paused players are not waited for
+	paused := playing["tidal-hifi:http://localhost:47836/current"]
+	paused.State = main.PlaybackPaused
+	_, ok = deduplicator.PreferredPlayer(
+		"dbus:org.mpris.MediaPlayer2.tidal-hifi",
+		scrobble,
+		map[string]main.PlaybackStatus{"tidal-hifi:http://localhost:47836/current": paused},
+	)
+	require.False(t, ok)
+
+	// the preferred player did not scrobble yet
+	_, ok = deduplicator.IsDuplicate("dbus:org.mpris.MediaPlayer2.tidal-hifi", scrobble)
+	require.False(t, ok)
+
+	deduplicator.Add("tidal-hifi:http://localhost:47836/current", scrobble)
+
+	later := scrobble
+	later.Timestamp = scrobble.Timestamp.Add(20 * time.Second)
+	_, ok = deduplicator.IsDuplicate("webhook:kitchen", later)
+	require.True(t, ok)
+
+	// same player (e.g., a track on repeat)
+	_, ok = deduplicator.IsDuplicate("tidal-hifi:http://localhost:47836/current", later)
+	require.False(t, ok)
+
+	later.Timestamp = scrobble.Timestamp.Add(time.Minute)
+	_, ok = deduplicator.IsDuplicate("webhook:kitchen", later)
+	require.False(t, ok)
+
+	var disabled *main.Deduplicator
+	_, ok = disabled.IsDuplicate("webhook:kitchen", scrobble)
+	require.False(t, ok)
+	_, ok = disabled.PreferredPlayer("webhook:kitchen", scrobble, playing)
+	require.False(t, ok)
+	disabled.Add("webhook:kitchen", scrobble)
+}
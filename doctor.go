@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Checker is implemented by sinks that can verify their configuration (e.g., credentials) without saving any
+// scrobbles. Check returns details displayed by `goscrobble doctor`.
+type Checker interface {
+	Check() (string, error)
+}
+
+type DoctorResult struct {
+	Kind    string
+	Key     string
+	Details string
+	Error   error
+}
+
+func (r DoctorResult) Status() string {
+	if r.Error != nil {
+		return "FAIL"
+	}
+	return "OK"
+}
+
+// Hint returns a remediation hint for failed checks, based on the type of the config entry.
+func (r DoctorResult) Hint() string {
+	if r.Error == nil {
+		return ""
+	}
+
+	entryType, _, _ := strings.Cut(r.Key, ".")
+	return doctorHints[entryType]
+}
+
+var doctorHints = map[string]string{
+	"dbus":          "make sure a D-Bus session bus is running or set `address` in [sources.dbus]",
+	"media-control": "install media-control (`brew install media-control`) or set `command` in [sources.media-control]",
+	"tidal-hifi":    "start tidal-hifi and enable its API in the settings, or remove [sources.tidal-hifi]",
+	"webhook":       "make sure the address is not used by another process (e.g., a running goscrobble daemon)",
+	"lastfm-proxy":  "make sure the address is not used by another process (e.g., a running goscrobble daemon)",
+	"http":          "check the URL and make sure the server is reachable",
+	"jellyfin":      "check the URL and API key, and make sure the server is reachable",
+	"subsonic":      "check the URL, username, and password, and make sure the server is reachable",
+	"lastfm":        "check the API key and secret, then run `goscrobble lastfm-auth <key>`",
+	"csv":           "make sure the directory exists and the file is writable",
+}
+
+// CheckSource gets the playback status once to verify that the source works.
+func CheckSource(setup SourceSetup) DoctorResult {
+	result := DoctorResult{Kind: "source", Key: setup.Key, Details: "", Error: setup.Error}
+	if setup.Error != nil {
+		return result
+	}
+
+	players, err := setup.Source.GetInfo()
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Details = fmt.Sprintf("%d player(s) found", len(players))
+	return result
+}
+
+// CheckSink runs the sink's [Checker], if implemented.
+func CheckSink(setup SinkSetup) DoctorResult {
+	result := DoctorResult{Kind: "sink", Key: setup.Key, Details: "", Error: setup.Error}
+	if setup.Error != nil {
+		return result
+	}
+
+	checker, ok := setup.Sink.(Checker)
+	if !ok {
+		result.Details = "no check available"
+		return result
+	}
+
+	result.Details, result.Error = checker.Check()
+	return result
+}
+
+// RunDoctor checks all configured sources and sinks.
+func RunDoctor(config Config) []DoctorResult {
+	var results []DoctorResult
+
+	for _, setup := range config.SourceSetups() {
+		results = append(results, CheckSource(setup))
+	}
+	for _, setup := range config.SinkSetups() {
+		results = append(results, CheckSink(setup))
+	}
+
+	return results
+}
@@ -0,0 +1,126 @@
+package main_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	lastfm "github.com/p-mng/lastfm-go"
+	"github.com/stretchr/testify/require"
+)
+
+const lastFmUserInfoResponse = `<?xml version="1.0" encoding="utf-8"?>
+<lfm status="ok">
+	<user>
+		<name>username</name>
+	</user>
+</lfm>`
+
+const lastFmInvalidAPIKeyResponse = `<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed">
+	<error code="10">Invalid API key - You must be granted a valid key by last.fm</error>
+</lfm>`
+
+const lastFmUserNotFoundResponse = `<?xml version="1.0" encoding="utf-8"?>
+<lfm status="failed">
+	<error code="6">User not found</error>
+</lfm>`
+
+func TestCheckSource(t *testing.T) {
+	result := main.CheckSource(main.SourceSetup{Key: "fake", Source: FakeSource{}, Error: nil})
+	require.NoError(t, result.Error)
+	require.Equal(t, "OK", result.Status())
+	require.Equal(t, "1 player(s) found", result.Details)
+	require.Empty(t, result.Hint())
+
+	result = main.CheckSource(main.SourceSetup{Key: "jellyfin.home", Source: FakeSource{Error: true}, Error: nil})
+	require.Error(t, result.Error)
+	require.Equal(t, "FAIL", result.Status())
+	require.Contains(t, result.Hint(), "API key")
+
+	result = main.CheckSource(main.SourceSetup{Key: "dbus", Source: nil, Error: errors.New("fake error")})
+	require.Error(t, result.Error)
+	require.Contains(t, result.Hint(), "D-Bus")
+}
+
+func TestCheckSinkCSV(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "scrobbles.csv")
+
+	result := main.CheckSink(main.SinkSetup{Key: "csv.default", Sink: main.CSVSink{Filename: filename}, Error: nil})
+	require.NoError(t, result.Error)
+	require.NoFileExists(t, filename)
+
+	require.NoError(t, os.WriteFile(filename, []byte{}, 0600))
+	result = main.CheckSink(main.SinkSetup{Key: "csv.default", Sink: main.CSVSink{Filename: filename}, Error: nil})
+	require.NoError(t, result.Error)
+
+	missing := filepath.Join(t.TempDir(), "missing", "scrobbles.csv")
+	result = main.CheckSink(main.SinkSetup{Key: "csv.default", Sink: main.CSVSink{Filename: missing}, Error: nil})
+	require.Error(t, result.Error)
+	require.Contains(t, result.Hint(), "writable")
+
+	result = main.CheckSink(main.SinkSetup{Key: "fake", Sink: &FakeSink{}, Error: nil})
+	require.NoError(t, result.Error)
+	require.Equal(t, "no check available", result.Details)
+}
+
+func TestCheckSinkLastFm(t *testing.T) {
+	userInfoResponse := lastFmUserInfoResponse
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the check must not modify the account
+		require.Equal(t, http.MethodGet, r.Method)
+		require.Contains(t, r.URL.RawQuery, "user.getInfo")
+		_, _ = w.Write([]byte(userInfoResponse))
+	}))
+	defer server.Close()
+
+	sink, err := main.LastFmSinkFromConfig(main.LastFmConfig{
+		BaseURL:    server.URL + "/",
+		Key:        fakeLastFmKey,
+		Secret:     fakeLastFmSecret,
+		SessionKey: "session key",
+		Username:   "username",
+	})
+	require.NoError(t, err)
+
+	result := main.CheckSink(main.SinkSetup{Key: "lastfm.default", Sink: sink, Error: nil})
+	require.NoError(t, result.Error)
+	require.Equal(t, "found user username (session key not verified)", result.Details)
+
+	userInfoResponse = lastFmInvalidAPIKeyResponse
+	result = main.CheckSink(main.SinkSetup{Key: "lastfm.default", Sink: sink, Error: nil})
+	require.ErrorContains(t, result.Error, "invalid API key")
+	require.Contains(t, result.Hint(), "lastfm-auth")
+
+	userInfoResponse = lastFmUserNotFoundResponse
+	result = main.CheckSink(main.SinkSetup{Key: "lastfm.default", Sink: sink, Error: nil})
+	require.ErrorContains(t, result.Error, "cannot get user info")
+}
+
+func TestLastFmErrorCode(t *testing.T) {
+	require.Equal(t, int64(0), main.LastFmErrorCode(nil))
+	require.Equal(t, int64(0), main.LastFmErrorCode(errors.New("fake error")))
+	require.Equal(t, int64(9), main.LastFmErrorCode(errors.New("Invalid session key (code 9)")))
+
+	// errors returned by the lastfm-go client
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(lastFmInvalidAPIKeyResponse))
+	}))
+	defer server.Close()
+
+	client, err := lastfm.NewDesktopClient(server.URL+"/", fakeLastFmKey, fakeLastFmSecret)
+	require.NoError(t, err)
+
+	_, err = client.UserGetInfo(lastfm.P{"user": "username"})
+	require.Error(t, err)
+	require.Equal(t, int64(10), main.LastFmErrorCode(err))
+
+	_, err = client.TrackUpdateNowPlaying(lastfm.P{"artist": "Placebo", "track": "Pure Morning", "sk": "session key"})
+	require.Error(t, err)
+	require.Equal(t, int64(10), main.LastFmErrorCode(err))
+}
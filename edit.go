@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScrobbleTimestampLayouts are accepted by `goscrobble scrobbles rm` and `edit`. RFC1123 is used by the
+// `scrobbles` table output, so timestamps can be copied from there.
+var ScrobbleTimestampLayouts = append([]string{time.RFC1123}, TimestampLayouts...)
+
+// ParseScrobbleTimestamp parses a timestamp in the local timezone using [ScrobbleTimestampLayouts].
+func ParseScrobbleTimestamp(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range ScrobbleTimestampLayouts {
+		if timestamp, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp: %s", value)
+}
+
+// ParseSelection parses a list of 1-based numbers and ranges (e.g., `1,3-5`) entered to select rows of a table with
+// count rows, and returns the sorted 0-based indexes.
+func ParseSelection(input string, count int) ([]int, error) {
+	var indexes []int
+
+	for part := range strings.SplitSeq(input, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection: %s", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(strings.TrimSpace(last)); err != nil {
+				return nil, fmt.Errorf("invalid selection: %s", part)
+			}
+		}
+
+		if start < 1 || end > count || start > end {
+			return nil, fmt.Errorf("selection out of range: %s", part)
+		}
+		for i := start; i <= end; i++ {
+			if !slices.Contains(indexes, i-1) {
+				indexes = append(indexes, i-1)
+			}
+		}
+	}
+
+	if len(indexes) == 0 {
+		return nil, errors.New("nothing selected")
+	}
+	slices.Sort(indexes)
+	return indexes, nil
+}
+
+// SelectEditSink returns the sink with a matching key or name (see [Config.SelectSink]), which must support editing.
+func (c Config) SelectEditSink(name string) (EditSink, error) {
+	sink, err := c.SelectSink(name)
+	if err != nil {
+		return nil, err
+	}
+
+	editSink, ok := sink.(EditSink)
+	if !ok {
+		return nil, fmt.Errorf(
+			"sink %s does not support deleting or editing scrobbles, use the website of the service instead",
+			sink.Name(),
+		)
+	}
+	return editSink, nil
+}
@@ -0,0 +1,115 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseScrobbleTimestamp(t *testing.T) {
+	expected := time.Date(2026, 10, 18, 20, 3, 0, 0, time.Local)
+
+	for _, value := range []string{
+		expected.Format(time.RFC1123),
+		"2026-10-18 20:03:00",
+		" 2026-10-18 20:03 ",
+		expected.Format(time.RFC3339),
+	} {
+		timestamp, err := main.ParseScrobbleTimestamp(value)
+		require.NoError(t, err)
+		require.True(t, expected.Equal(timestamp), value)
+	}
+
+	_, err := main.ParseScrobbleTimestamp("yesterday")
+	require.Error(t, err)
+}
+
+func TestParseSelection(t *testing.T) {
+	indexes, err := main.ParseSelection("4, 1-2,2", 5)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 1, 3}, indexes)
+
+	for _, input := range []string{"", " , ", "0", "6", "3-1", "1-x", "one"} {
+		_, err := main.ParseSelection(input, 5)
+		require.Error(t, err, input)
+	}
+}
+
+func TestCSVSinkEdit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "scrobbles.csv")
+	sink := main.CSVSink{Filename: filename}
+
+	_, err := sink.DeleteScrobbles([]time.Time{time.Now()})
+	require.Error(t, err)
+
+	start := time.Date(2026, 10, 18, 20, 0, 0, 0, time.Local)
+	for i, track := range []string{"One", "Two", "Three"} {
+		scrobble := defaultScrobble
+		scrobble.Track = track
+		scrobble.Timestamp = start.Add(time.Duration(i) * 3 * time.Minute)
+		require.NoError(t, sink.Scrobble(scrobble))
+	}
+	require.NoError(t, os.Chmod(filename, 0640))
+
+	edited := defaultScrobble
+	edited.Track = "Deux"
+	edited.Timestamp = start.Add(3 * time.Minute)
+	count, err := sink.EditScrobble(edited)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	count, err = sink.DeleteScrobbles([]time.Time{start, start.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	count, err = sink.DeleteScrobbles([]time.Time{start})
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	scrobbles, err := sink.GetScrobbles(0, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, scrobbles, 2)
+	require.Equal(t, "Three", scrobbles[0].Track)
+	require.Equal(t, "Deux", scrobbles[1].Track)
+
+	scrobbles, err = sink.GetScrobbles(0, edited.Timestamp, edited.Timestamp)
+	require.NoError(t, err)
+	require.Len(t, scrobbles, 1)
+	require.Equal(t, "Deux", scrobbles[0].Track)
+
+	info, err := os.Stat(filename)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestSelectEditSink(t *testing.T) {
+	config := main.DefaultConfig
+	config.Sinks.LastFm = map[string]main.LastFmConfig{
+		"default": {
+			BaseURL:    "",
+			Key:        strings.Repeat("0", 32),
+			Secret:     strings.Repeat("0", 32),
+			SessionKey: "session",
+			Username:   "user",
+		},
+	}
+
+	sink, err := config.SelectEditSink("csv.default")
+	require.NoError(t, err)
+	require.Equal(t, "csv", sink.Name())
+
+	_, err = config.SelectEditSink("last.fm")
+	require.ErrorContains(t, err, "does not support deleting or editing scrobbles")
+
+	_, err = config.SelectEditSink("")
+	require.ErrorContains(t, err, "no sink provided")
+
+	config.Sinks.CSV = map[string]main.CSVConfig{"a": {Filename: "a.csv"}, "b": {Filename: "b.csv"}}
+	_, err = config.SelectEditSink("csv")
+	require.ErrorContains(t, err, "use the sink key instead")
+}
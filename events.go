@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type EventType string
+
+const (
+	EventPlayerAppeared    = EventType("player_appeared")
+	EventPlayerDisappeared = EventType("player_disappeared")
+	EventBlacklisted       = EventType("blacklisted")
+	EventFiltered          = EventType("filtered")
+	EventMissingMetadata   = EventType("missing_metadata")
+	EventRewritten         = EventType("rewritten")
+	EventNewTrack          = EventType("new_track")
+	EventNowPlayingSent    = EventType("now_playing_sent")
+	EventNowPlayingFailed  = EventType("now_playing_failed")
+	EventThresholdReached  = EventType("threshold_reached")
+	EventDuplicate         = EventType("duplicate")
+	EventScrobbleSent      = EventType("scrobble_sent")
+	EventScrobbleFailed    = EventType("scrobble_failed")
+)
+
+var EventTypes = []EventType{
+	EventPlayerAppeared,
+	EventPlayerDisappeared,
+	EventBlacklisted,
+	EventFiltered,
+	EventMissingMetadata,
+	EventRewritten,
+	EventNewTrack,
+	EventNowPlayingSent,
+	EventNowPlayingFailed,
+	EventThresholdReached,
+	EventDuplicate,
+	EventScrobbleSent,
+	EventScrobbleFailed,
+}
+
+// Event is a single entry of the event log. Before is the scrobble reported by the source, After is the scrobble
+// after applying regexes and corrections.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   EventType `json:"type"`
+	Player string    `json:"player,omitempty"`
+	Sink   string    `json:"sink,omitempty"`
+	Before *Scrobble `json:"before,omitempty"`
+	After  *Scrobble `json:"after,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// EventLog appends events to a newline-delimited JSON file. All methods are no-ops if the event log is nil.
+type EventLog struct {
+	Filename string
+	File     *os.File
+}
+
+func OpenEventLog(filename string) (*EventLog, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+
+	//nolint:gosec
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().
+		Str("filename", filename).
+		Msg("opened event log")
+
+	return &EventLog{Filename: filename, File: file}, nil
+}
+
+func (l *EventLog) Log(event Event) {
+	if l == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("error encoding event")
+		return
+	}
+
+	if _, err := l.File.Write(append(data, '\n')); err != nil {
+		log.Error().
+			Str("filename", l.Filename).
+			Err(err).
+			Msg("error writing event log")
+	}
+}
+
+// LogScrobble logs an event for a scrobble of a player. The sink and error are optional.
+func (l *EventLog) LogScrobble(eventType EventType, player, sink string, before, after Scrobble, err error) {
+	if l == nil {
+		return
+	}
+
+	event := Event{
+		Time:   time.Time{},
+		Type:   eventType,
+		Player: player,
+		Sink:   sink,
+		Before: &before,
+		After:  &after,
+		Error:  "",
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	l.Log(event)
+}
+
+func (l *EventLog) Close() {
+	if l == nil {
+		return
+	}
+	CloseLogged(l.File)
+}
+
+// EventFilter selects events printed by `goscrobble events`. Empty fields match all events.
+type EventFilter struct {
+	Types  []EventType
+	Player string
+	Since  time.Time
+}
+
+func (f EventFilter) Matches(event Event) bool {
+	switch {
+	case len(f.Types) > 0 && !slices.Contains(f.Types, event.Type):
+		return false
+	case f.Player != "" && !strings.Contains(event.Player, f.Player):
+		return false
+	case event.Time.Before(f.Since):
+		return false
+	default:
+		return true
+	}
+}
+
+// ReadEvents reads all events matching the filter and returns the file offset after the last complete line.
+// Invalid lines are skipped.
+func ReadEvents(reader io.Reader, filter EventFilter, fn func(Event, []byte)) (int64, error) {
+	var offset int64
+
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		} else if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("skipping invalid event log entry")
+			continue
+		}
+
+		if filter.Matches(event) {
+			fn(event, line)
+		}
+	}
+}
+
+// FollowEvents reads new events appended to the event log until the context is canceled.
+func FollowEvents(ctx context.Context, filename string, offset int64, filter EventFilter, fn func(Event, []byte)) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		//nolint:gosec
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+
+		stat, err := file.Stat()
+		if err != nil {
+			CloseLogged(file)
+			return err
+		}
+		if stat.Size() < offset {
+			// the event log was truncated or replaced
+			offset = 0
+		}
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			CloseLogged(file)
+			return err
+		}
+
+		read, err := ReadEvents(file, filter, fn)
+		CloseLogged(file)
+		if err != nil {
+			return err
+		}
+		offset += read
+	}
+}
+
+func (e Event) String() string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "%s %-18s", e.Time.Format(time.DateTime), e.Type)
+	if e.Player != "" {
+		fmt.Fprintf(&builder, " player=%s", e.Player)
+	}
+	if e.Sink != "" {
+		fmt.Fprintf(&builder, " sink=%s", e.Sink)
+	}
+
+	switch {
+	case e.After != nil:
+		fmt.Fprintf(&builder, " track=%q artists=%q", e.After.Track, e.After.JoinArtists())
+	case e.Before != nil:
+		fmt.Fprintf(&builder, " track=%q artists=%q", e.Before.Track, e.Before.JoinArtists())
+	}
+
+	if e.Type == EventRewritten && e.Before != nil {
+		fmt.Fprintf(&builder, " original_track=%q original_artists=%q", e.Before.Track, e.Before.JoinArtists())
+	}
+	if e.Error != "" {
+		fmt.Fprintf(&builder, " error=%q", e.Error)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,146 @@
+package main_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func readEvents(t *testing.T, filename string, filter main.EventFilter) []main.Event {
+	t.Helper()
+
+	//nolint:gosec
+	file, err := os.Open(filename)
+	require.NoError(t, err)
+	defer main.CloseLogged(file)
+
+	var events []main.Event
+	_, err = main.ReadEvents(file, filter, func(event main.Event, _ []byte) {
+		events = append(events, event)
+	})
+	require.NoError(t, err)
+
+	return events
+}
+
+func TestEventLog(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", "events.ndjson")
+
+	eventLog, err := main.OpenEventLog(filename)
+	require.NoError(t, err)
+
+	original := defaultScrobble
+	original.Track = "Without You I'm Nothing - 2015 Remaster"
+
+	eventLog.LogScrobble(main.EventRewritten, "fake player", "", original, defaultScrobble, nil)
+	eventLog.LogScrobble(main.EventScrobbleFailed, "other player", "csv", defaultScrobble, defaultScrobble, os.ErrPermission)
+	eventLog.Close()
+
+	var disabled *main.EventLog
+	disabled.LogScrobble(main.EventNewTrack, "fake player", "", defaultScrobble, defaultScrobble, nil)
+	disabled.Close()
+
+	events := readEvents(t, filename, main.EventFilter{Types: nil, Player: "", Since: time.Time{}})
+	require.Len(t, events, 2)
+	require.Equal(t, original.Track, events[0].Before.Track)
+	require.True(t, original.Timestamp.Equal(events[0].Before.Timestamp))
+	require.Equal(t, defaultScrobble.Track, events[0].After.Track)
+	require.Equal(t, defaultScrobble.Duration, events[0].After.Duration)
+	require.Contains(t, events[0].String(), `original_track="Without You I'm Nothing - 2015 Remaster"`)
+	require.Equal(t, "permission denied", events[1].Error)
+
+	events = readEvents(t, filename, main.EventFilter{Types: []main.EventType{main.EventScrobbleFailed}, Player: "", Since: time.Time{}})
+	require.Len(t, events, 1)
+
+	events = readEvents(t, filename, main.EventFilter{Types: nil, Player: "fake", Since: time.Time{}})
+	require.Len(t, events, 1)
+
+	events = readEvents(t, filename, main.EventFilter{Types: nil, Player: "", Since: time.Now().Add(time.Hour)})
+	require.Empty(t, events)
+
+	offset, err := main.ReadEvents(strings.NewReader("invalid\n{\"type\": \"new_track\"}\n{\"type\""), main.EventFilter{}, func(main.Event, []byte) {})
+	require.NoError(t, err)
+	require.Equal(t, int64(len("invalid\n{\"type\": \"new_track\"}\n")), offset)
+}
+
+func TestFollowEvents(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "events.ndjson")
+
+	eventLog, err := main.OpenEventLog(filename)
+	require.NoError(t, err)
+	defer eventLog.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	received := make(chan main.Event, 1)
+	go func() {
+		_ = main.FollowEvents(ctx, filename, 0, main.EventFilter{}, func(event main.Event, _ []byte) {
+			received <- event
+			cancel()
+		})
+	}()
+
+	eventLog.LogScrobble(main.EventNewTrack, "fake player", "", defaultScrobble, defaultScrobble, nil)
+
+	select {
+	case event := <-received:
+		require.Equal(t, main.EventNewTrack, event.Type)
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+}
+
+func TestMainLoopEventLog(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	blacklistedSource := &FakeSource{
+		PlayerName:     "blacklisted player",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+
+	config := main.DefaultConfig
+	config.EventLog = filepath.Join(t.TempDir(), "events.ndjson")
+	config.Blacklist = []string{"blacklisted"}
+
+	loop := main.NewMainLoop(
+		config,
+		[]main.Source{fakeSource, blacklistedSource},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	)
+
+	loop.RunOnce()
+	fakeSource.PlaybackStatus.Position = time.Duration(time.Second * 200)
+	loop.RunOnce()
+	fakeSource.Empty = true
+	loop.RunOnce()
+
+	var types []main.EventType
+	for _, event := range readEvents(t, config.EventLog, main.EventFilter{}) {
+		types = append(types, event.Type)
+	}
+	require.Equal(t, []main.EventType{
+		main.EventBlacklisted,
+		main.EventPlayerAppeared,
+		main.EventNewTrack,
+		main.EventNowPlayingSent,
+		main.EventThresholdReached,
+		main.EventScrobbleSent,
+		main.EventPlayerDisappeared,
+	}, types)
+}
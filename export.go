@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Formats supported by `goscrobble export` and `goscrobble import`.
+const (
+	FormatJSON         = "json"
+	FormatNDJSON       = "ndjson"
+	FormatListenBrainz = "listenbrainz"
+	FormatScrobblerLog = "scrobbler-log"
+)
+
+var Formats = []string{FormatJSON, FormatNDJSON, FormatListenBrainz, FormatScrobblerLog}
+
+// ExportPageSize is the number of scrobbles fetched from a sink at once (the maximum page size of the last.fm API).
+const ExportPageSize = 200
+
+// ExportClient is written to the header of `.scrobbler.log` files and the submission client of ListenBrainz listens.
+const ExportClient = "goscrobble"
+
+// DetectFormat returns the format matching the file extension (`.scrobbler.log` and `.log`, `.ndjson` and `.jsonl`),
+// or JSON. The ListenBrainz format cannot be detected, since it also uses JSON files.
+func DetectFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".log":
+		return FormatScrobblerLog
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	default:
+		return FormatJSON
+	}
+}
+
+// ListenBrainzListen is a listen in the JSON format used by ListenBrainz exports and the submission API.
+//
+// https://listenbrainz.readthedocs.io/en/latest/users/json.html
+type ListenBrainzListen struct {
+	ListenedAt    int64                     `json:"listened_at"`
+	TrackMetadata ListenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type ListenBrainzTrackMetadata struct {
+	ArtistName     string                     `json:"artist_name"`
+	TrackName      string                     `json:"track_name"`
+	ReleaseName    string                     `json:"release_name,omitempty"`
+	AdditionalInfo ListenBrainzAdditionalInfo `json:"additional_info"`
+	// MBIDMapping is added by ListenBrainz to exported listens, if the listen was linked to MusicBrainz.
+	MBIDMapping *ListenBrainzMBIDMapping `json:"mbid_mapping,omitempty"`
+}
+
+type ListenBrainzAdditionalInfo struct {
+	DurationMs       int64    `json:"duration_ms,omitempty"`
+	RecordingMBID    string   `json:"recording_mbid,omitempty"`
+	ReleaseMBID      string   `json:"release_mbid,omitempty"`
+	ArtistMBIDs      []string `json:"artist_mbids,omitempty"`
+	SubmissionClient string   `json:"submission_client,omitempty"`
+}
+
+type ListenBrainzMBIDMapping struct {
+	RecordingMBID string   `json:"recording_mbid,omitempty"`
+	ReleaseMBID   string   `json:"release_mbid,omitempty"`
+	ArtistMBIDs   []string `json:"artist_mbids,omitempty"`
+}
+
+func ListenBrainzListenFromScrobble(scrobble Scrobble) ListenBrainzListen {
+	return ListenBrainzListen{
+		ListenedAt: scrobble.Timestamp.Unix(),
+		TrackMetadata: ListenBrainzTrackMetadata{
+			ArtistName:  scrobble.JoinArtists(),
+			TrackName:   scrobble.Track,
+			ReleaseName: scrobble.Album,
+			AdditionalInfo: ListenBrainzAdditionalInfo{
+				DurationMs:       scrobble.Duration.Milliseconds(),
+				RecordingMBID:    scrobble.MBIDs.Recording,
+				ReleaseMBID:      scrobble.MBIDs.Release,
+				ArtistMBIDs:      scrobble.MBIDs.Artists,
+				SubmissionClient: ExportClient,
+			},
+			MBIDMapping: nil,
+		},
+	}
+}
+
+// Scrobble converts a listen, using the MBIDs of the MusicBrainz mapping if the listen has none.
+func (l ListenBrainzListen) Scrobble() Scrobble {
+	info := l.TrackMetadata.AdditionalInfo
+
+	mbids := MBIDs{Recording: info.RecordingMBID, Release: info.ReleaseMBID, Artists: info.ArtistMBIDs}
+	if mapping := l.TrackMetadata.MBIDMapping; mapping != nil && mbids.Recording == "" {
+		mbids = MBIDs{Recording: mapping.RecordingMBID, Release: mapping.ReleaseMBID, Artists: mapping.ArtistMBIDs}
+	}
+
+	return Scrobble{
+		// FIXME: this does not work in some cases (e.g., "Tyler, the Creator")
+		Artists:   strings.Split(l.TrackMetadata.ArtistName, ", "),
+		Track:     l.TrackMetadata.TrackName,
+		Album:     l.TrackMetadata.ReleaseName,
+		Duration:  time.Duration(info.DurationMs) * time.Millisecond,
+		Timestamp: time.Unix(l.ListenedAt, 0),
+		MBIDs:     mbids,
+	}
+}
+
+// ScrobbleWriter writes scrobbles in one of the export formats.
+type ScrobbleWriter interface {
+	Write(Scrobble) error
+	// Close finishes the output (e.g., the end of a JSON array), but does not close the underlying writer.
+	Close() error
+}
+
+func NewScrobbleWriter(format string, w io.Writer) (ScrobbleWriter, error) {
+	switch format {
+	case FormatJSON:
+		return &JSONScrobbleWriter{Writer: w, Lines: false, Convert: nil, count: 0}, nil
+	case FormatNDJSON:
+		return &JSONScrobbleWriter{Writer: w, Lines: true, Convert: nil, count: 0}, nil
+	case FormatListenBrainz:
+		convert := func(scrobble Scrobble) any {
+			return ListenBrainzListenFromScrobble(scrobble)
+		}
+		return &JSONScrobbleWriter{Writer: w, Lines: false, Convert: convert, count: 0}, nil
+	case FormatScrobblerLog:
+		return &ScrobblerLogWriter{Writer: w, header: false}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s (valid formats: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// JSONScrobbleWriter writes a JSON array, or one JSON object per line if Lines is set. Values are converted using
+// Convert if set, scrobbles are written as is otherwise.
+type JSONScrobbleWriter struct {
+	Writer  io.Writer
+	Lines   bool
+	Convert func(Scrobble) any
+
+	count int
+}
+
+func (w *JSONScrobbleWriter) Write(scrobble Scrobble) error {
+	var value any = scrobble
+	if w.Convert != nil {
+		value = w.Convert(scrobble)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if w.Lines {
+		_, err = fmt.Fprintf(w.Writer, "%s\n", data)
+		return err
+	}
+
+	prefix := ",\n"
+	if w.count == 0 {
+		prefix = "[\n"
+	}
+	w.count++
+
+	_, err = fmt.Fprintf(w.Writer, "%s%s", prefix, data)
+	return err
+}
+
+func (w *JSONScrobbleWriter) Close() error {
+	var err error
+	switch {
+	case w.Lines:
+		return nil
+	case w.count == 0:
+		_, err = fmt.Fprintln(w.Writer, "[]")
+	default:
+		_, err = fmt.Fprintln(w.Writer, "\n]")
+	}
+	return err
+}
+
+// ScrobblerLogWriter writes the `.scrobbler.log` format of the Audioscrobbler portable player logging
+// specification. Timestamps are written in UTC.
+//
+// https://web.archive.org/web/20170107015006/http://www.audioscrobbler.net/wiki/Portable_Player_Logging
+type ScrobblerLogWriter struct {
+	Writer io.Writer
+
+	header bool
+}
+
+func (w *ScrobblerLogWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+
+	_, err := fmt.Fprintf(w.Writer, "#AUDIOSCROBBLER/1.1\n#TZ/UTC\n#CLIENT/%s\n", ExportClient)
+	return err
+}
+
+func (w *ScrobblerLogWriter) Write(scrobble Scrobble) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	// fields are separated by tabs, so tabs and line breaks cannot be used in values
+	clean := strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace
+
+	fields := []string{
+		clean(scrobble.JoinArtists()),
+		clean(scrobble.Album),
+		clean(scrobble.Track),
+		// track number, which is not known
+		"",
+		strconv.FormatInt(int64(scrobble.Duration.Seconds()), 10),
+		// listened (tracks that were skipped are not scrobbled)
+		"L",
+		strconv.FormatInt(scrobble.Timestamp.Unix(), 10),
+		clean(scrobble.MBIDs.Recording),
+	}
+
+	_, err := fmt.Fprintln(w.Writer, strings.Join(fields, "\t"))
+	return err
+}
+
+func (w *ScrobblerLogWriter) Close() error {
+	// an empty file still has a header
+	return w.writeHeader()
+}
+
+// ExportScrobbles writes the scrobbles of a sink between from and to (newest first) and returns the number of
+// written scrobbles. Scrobbles are fetched in pages of pageSize scrobbles, so the history does not need to fit in
+// memory. Sinks must return the newest scrobbles first.
+func ExportScrobbles(sink Sink, writer ScrobbleWriter, from, to time.Time, pageSize int) (int, error) {
+	count := 0
+	// scrobbles with the timestamp of the oldest scrobble of the previous page, which are fetched again, since the
+	// next page ends at that timestamp
+	var boundary []Scrobble
+
+	for {
+		page, err := sink.GetScrobbles(pageSize, from, to)
+		if err != nil {
+			return count, err
+		}
+		full := len(page) >= pageSize
+
+		// the currently playing track returned by last.fm has no timestamp
+		page = FilterScrobbles(page, from, to)
+		if len(page) == 0 {
+			return count, nil
+		}
+
+		log.Debug().
+			Str("sink", sink.Name()).
+			Int("scrobbles", len(page)).
+			Time("to", to).
+			Msg("exporting scrobbles")
+
+		written := 0
+		for _, scrobble := range page {
+			if slices.ContainsFunc(boundary, func(other Scrobble) bool {
+				return other.Timestamp.Equal(scrobble.Timestamp) && IsSameTrack(other, scrobble)
+			}) {
+				continue
+			}
+
+			if err := writer.Write(scrobble); err != nil {
+				return count, err
+			}
+			count++
+			written++
+		}
+
+		if !full {
+			return count, nil
+		}
+
+		oldest := slices.MinFunc(page, func(a, b Scrobble) int {
+			return a.Timestamp.Compare(b.Timestamp)
+		}).Timestamp
+
+		if written == 0 {
+			// the whole page has the same timestamp, continue with older scrobbles
+			to = oldest.Add(-time.Second)
+			boundary = nil
+			continue
+		}
+
+		to = oldest
+		boundary = slices.DeleteFunc(page, func(scrobble Scrobble) bool {
+			return !scrobble.Timestamp.Equal(oldest)
+		})
+	}
+}
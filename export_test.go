@@ -0,0 +1,171 @@
+package main_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+// HistorySink returns its scrobbles like last.fm: newest first, limited to the given time range.
+type HistorySink struct {
+	History  []main.Scrobble
+	Requests int
+}
+
+func (*HistorySink) Name() string {
+	return "history sink"
+}
+
+func (*HistorySink) NowPlaying(_ main.Scrobble) error {
+	return nil
+}
+
+func (s *HistorySink) Scrobble(scrobble main.Scrobble) error {
+	s.History = append(s.History, scrobble)
+	return nil
+}
+
+func (s *HistorySink) GetScrobbles(limit int, from, to time.Time) ([]main.Scrobble, error) {
+	s.Requests++
+
+	var scrobbles []main.Scrobble
+	for _, scrobble := range s.History {
+		if !scrobble.Timestamp.Before(from) && !scrobble.Timestamp.After(to) {
+			scrobbles = append(scrobbles, scrobble)
+		}
+	}
+	slices.SortStableFunc(scrobbles, func(a, b main.Scrobble) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	if limit > 0 && len(scrobbles) > limit {
+		scrobbles = scrobbles[:limit]
+	}
+	return scrobbles, nil
+}
+
+func TestDetectFormat(t *testing.T) {
+	require.Equal(t, main.FormatScrobblerLog, main.DetectFormat("/media/ipod/.scrobbler.log"))
+	require.Equal(t, main.FormatNDJSON, main.DetectFormat("scrobbles.jsonl"))
+	require.Equal(t, main.FormatNDJSON, main.DetectFormat("scrobbles.NDJSON"))
+	require.Equal(t, main.FormatJSON, main.DetectFormat("scrobbles.json"))
+	require.Equal(t, main.FormatJSON, main.DetectFormat(""))
+}
+
+func TestExportScrobbles(t *testing.T) {
+	start := time.Unix(1699225080, 0)
+
+	sink := &HistorySink{}
+	for i := range 10 {
+		scrobble := defaultScrobble
+		scrobble.Track = string(rune('A' + i))
+		scrobble.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		sink.History = append(sink.History, scrobble)
+	}
+	// scrobbles with the same timestamp on a page boundary
+	for _, track := range []string{"X", "Y", "Z"} {
+		scrobble := defaultScrobble
+		scrobble.Track = track
+		scrobble.Timestamp = start.Add(5 * time.Minute)
+		sink.History = append(sink.History, scrobble)
+	}
+
+	var buffer bytes.Buffer
+	writer, err := main.NewScrobbleWriter(main.FormatNDJSON, &buffer)
+	require.NoError(t, err)
+
+	count, err := main.ExportScrobbles(sink, writer, start, start.Add(time.Hour), 4)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.Equal(t, 13, count)
+	require.Greater(t, sink.Requests, 3)
+
+	reader, err := main.NewScrobbleReader(main.FormatNDJSON, &buffer)
+	require.NoError(t, err)
+
+	var tracks []string
+	for {
+		scrobble, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		tracks = append(tracks, scrobble.Track)
+	}
+	slices.Sort(tracks)
+	require.Equal(t, []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J", "X", "Y", "Z"}, tracks)
+
+	// a time range without scrobbles
+	buffer.Reset()
+	writer, err = main.NewScrobbleWriter(main.FormatJSON, &buffer)
+	require.NoError(t, err)
+	count, err = main.ExportScrobbles(sink, writer, start.Add(time.Hour), start.Add(2*time.Hour), 4)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.Equal(t, 0, count)
+	require.Equal(t, "[]\n", buffer.String())
+}
+
+func TestScrobbleWriterRoundTrip(t *testing.T) {
+	scrobble := defaultScrobble
+	scrobble.MBIDs = main.MBIDs{
+		Recording: "5b1a5d5c-7b4f-4d8f-9a2e-7b7b5e0c6f1a",
+		Release:   "",
+		Artists:   nil,
+	}
+
+	for _, format := range main.Formats {
+		var buffer bytes.Buffer
+		writer, err := main.NewScrobbleWriter(format, &buffer)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(scrobble))
+		require.NoError(t, writer.Write(scrobble))
+		require.NoError(t, writer.Close())
+
+		reader, err := main.NewScrobbleReader(format, &buffer)
+		require.NoError(t, err)
+
+		for range 2 {
+			read, err := reader.Read()
+			require.NoError(t, err, format)
+			require.Equal(t, scrobble.Track, read.Track, format)
+			require.Equal(t, scrobble.Album, read.Album, format)
+			require.Equal(t, scrobble.Duration, read.Duration, format)
+			require.True(t, scrobble.Timestamp.Equal(read.Timestamp), format)
+			require.Equal(t, scrobble.MBIDs.Recording, read.MBIDs.Recording, format)
+			// the scrobbler log format only stores the joined artists
+			require.Equal(t, scrobble.JoinArtists(), read.JoinArtists(), format)
+		}
+
+		_, err = reader.Read()
+		require.ErrorIs(t, err, io.EOF, format)
+	}
+
+	_, err := main.NewScrobbleWriter("xml", io.Discard)
+	require.ErrorContains(t, err, "invalid format")
+}
+
+func TestScrobblerLogWriter(t *testing.T) {
+	scrobble := defaultScrobble
+	scrobble.Track = "Without\tYou"
+
+	var buffer bytes.Buffer
+	writer, err := main.NewScrobbleWriter(main.FormatScrobblerLog, &buffer)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(scrobble))
+	require.NoError(t, writer.Close())
+
+	lines := strings.Split(buffer.String(), "\n")
+	require.Equal(t, []string{"#AUDIOSCROBBLER/1.1", "#TZ/UTC", "#CLIENT/goscrobble"}, lines[:3])
+	require.Equal(
+		t,
+		"Placebo, David Bowie\tA Place For Us To Dream\tWithout You\t\t251\tL\t1699225080\t",
+		lines[3],
+	)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ImportBatchSize is the number of scrobbles sent to sinks at once (the maximum batch size of the last.fm API).
+const ImportBatchSize = LastFmMaxBatchSize
+
+// ScrobbleReader reads scrobbles in one of the export formats.
+type ScrobbleReader interface {
+	// Read returns the next scrobble, or [io.EOF] if all scrobbles were read.
+	Read() (Scrobble, error)
+}
+
+func NewScrobbleReader(format string, r io.Reader) (ScrobbleReader, error) {
+	switch format {
+	case FormatJSON, FormatNDJSON:
+		decode := func(decoder *json.Decoder) (Scrobble, error) {
+			var scrobble Scrobble
+			err := decoder.Decode(&scrobble)
+			return scrobble, err
+		}
+		return NewJSONScrobbleReader(r, decode), nil
+	case FormatListenBrainz:
+		decode := func(decoder *json.Decoder) (Scrobble, error) {
+			var listen ListenBrainzListen
+			err := decoder.Decode(&listen)
+			return listen.Scrobble(), err
+		}
+		return NewJSONScrobbleReader(r, decode), nil
+	case FormatScrobblerLog:
+		return &ScrobblerLogReader{Scanner: bufio.NewScanner(r), Location: time.UTC, line: 0}, nil
+	default:
+		return nil, fmt.Errorf("invalid format: %s (valid formats: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// ReadScrobbleBatches reads all scrobbles, applies the regexes, and calls handle with batches of up to size
+// scrobbles. Scrobbles without artist or track are skipped, the number of skipped scrobbles is returned.
+func ReadScrobbleBatches(
+	reader ScrobbleReader,
+	regexes []ParsedRegexReplace,
+	size int,
+	handle func([]Scrobble) error,
+) (int, error) {
+	skipped := 0
+	batch := make([]Scrobble, 0, size)
+
+	for {
+		scrobble, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return skipped, err
+		}
+
+		scrobble.RegexReplace(regexes)
+		if scrobble.JoinArtists() == "" || scrobble.Track == "" {
+			log.Warn().
+				Interface("scrobble", scrobble).
+				Msg("skipping scrobble without artist or track")
+			skipped++
+			continue
+		}
+
+		batch = append(batch, scrobble)
+		if len(batch) >= size {
+			if err := handle(batch); err != nil {
+				return skipped, err
+			}
+			batch = make([]Scrobble, 0, size)
+		}
+	}
+
+	if len(batch) == 0 {
+		return skipped, nil
+	}
+	return skipped, handle(batch)
+}
+
+// JSONScrobbleReader reads a JSON array, or a stream of JSON objects (e.g., one object per line), using Decode.
+type JSONScrobbleReader struct {
+	Reader *bufio.Reader
+	Decode func(*json.Decoder) (Scrobble, error)
+
+	// decoder is created when reading the first scrobble, after checking if the input is an array
+	decoder *json.Decoder
+	array   bool
+	count   int
+}
+
+func NewJSONScrobbleReader(r io.Reader, decode func(*json.Decoder) (Scrobble, error)) *JSONScrobbleReader {
+	return &JSONScrobbleReader{Reader: bufio.NewReader(r), Decode: decode, decoder: nil, array: false, count: 0}
+}
+
+func (r *JSONScrobbleReader) Read() (Scrobble, error) {
+	if r.decoder == nil {
+		array, err := isJSONArray(r.Reader)
+		if err != nil {
+			return Scrobble{}, err
+		}
+
+		r.array = array
+		r.decoder = json.NewDecoder(r.Reader)
+		if array {
+			// opening bracket
+			if _, err := r.decoder.Token(); err != nil {
+				return Scrobble{}, err
+			}
+		}
+	}
+
+	if r.array && !r.decoder.More() {
+		return Scrobble{}, io.EOF
+	}
+
+	scrobble, err := r.Decode(r.decoder)
+	if errors.Is(err, io.EOF) {
+		return Scrobble{}, io.EOF
+	} else if err != nil {
+		return Scrobble{}, fmt.Errorf("entry %d: %w", r.count+1, err)
+	}
+	r.count++
+
+	return scrobble, nil
+}
+
+// isJSONArray skips leading whitespace and checks if the next character starts an array.
+func isJSONArray(r *bufio.Reader) (bool, error) {
+	for {
+		next, err := r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		if !unicode.IsSpace(rune(next[0])) {
+			return next[0] == '[', nil
+		}
+		if _, err := r.ReadByte(); err != nil {
+			return false, err
+		}
+	}
+}
+
+// ScrobblerLogReader reads the `.scrobbler.log` format written by portable players (e.g., Rockbox). Skipped
+// tracks are not returned. Timestamps are read in Location, which is set to the local timezone if the header
+// contains `#TZ/UNKNOWN`, since the player clock is usually set to local time.
+//
+// https://web.archive.org/web/20170107015006/http://www.audioscrobbler.net/wiki/Portable_Player_Logging
+type ScrobblerLogReader struct {
+	Scanner  *bufio.Scanner
+	Location *time.Location
+
+	line int
+}
+
+func (r *ScrobblerLogReader) Read() (Scrobble, error) {
+	for r.Scanner.Scan() {
+		r.line++
+		line := strings.TrimSuffix(r.Scanner.Text(), "\r")
+
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			if timezone, ok := strings.CutPrefix(line, "#TZ/"); ok && timezone == "UNKNOWN" {
+				r.Location = time.Local
+			}
+			continue
+		}
+
+		scrobble, skipped, err := r.parse(line)
+		if err != nil {
+			return Scrobble{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if !skipped {
+			return scrobble, nil
+		}
+	}
+
+	if err := r.Scanner.Err(); err != nil {
+		return Scrobble{}, err
+	}
+	return Scrobble{}, io.EOF
+}
+
+// parse reads an entry (artist, album, track, track number, duration, rating, timestamp, and MBID, separated by
+// tabs) and returns true if the track was skipped.
+func (r *ScrobblerLogReader) parse(line string) (Scrobble, bool, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 7 {
+		return Scrobble{}, false, fmt.Errorf("expected at least 7 fields, got %d", len(fields))
+	}
+
+	if fields[5] == "S" {
+		return Scrobble{}, true, nil
+	}
+
+	var duration time.Duration
+	if fields[4] != "" {
+		seconds, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return Scrobble{}, false, fmt.Errorf("invalid duration: %s", fields[4])
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	unix, err := strconv.ParseInt(fields[6], 10, 64)
+	if err != nil {
+		return Scrobble{}, false, fmt.Errorf("invalid timestamp: %s", fields[6])
+	}
+	timestamp := time.Unix(unix, 0).UTC()
+	if r.Location != time.UTC {
+		// the timestamp is the local time of the player, written as if it was UTC
+		timestamp = time.Date(
+			timestamp.Year(), timestamp.Month(), timestamp.Day(),
+			timestamp.Hour(), timestamp.Minute(), timestamp.Second(), 0,
+			r.Location,
+		)
+	}
+
+	var mbid string
+	if len(fields) > 7 {
+		mbid = fields[7]
+	}
+
+	return Scrobble{
+		Artists:   []string{fields[0]},
+		Track:     fields[2],
+		Album:     fields[1],
+		Duration:  duration,
+		Timestamp: timestamp.In(time.Local),
+		MBIDs:     MBIDs{Recording: mbid, Release: "", Artists: nil},
+	}, false, nil
+}
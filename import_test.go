@@ -0,0 +1,150 @@
+package main_test
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllScrobbles(t *testing.T, reader main.ScrobbleReader) []main.Scrobble {
+	t.Helper()
+
+	var scrobbles []main.Scrobble
+	for {
+		scrobble, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return scrobbles
+		}
+		require.NoError(t, err)
+		scrobbles = append(scrobbles, scrobble)
+	}
+}
+
+func TestScrobblerLogReader(t *testing.T) {
+	input := "#AUDIOSCROBBLER/1.1\r\n" +
+		"#TZ/UTC\r\n" +
+		"#CLIENT/Rockbox ipodvideo $Revision$\r\n" +
+		"Placebo\tMeds\tMeds\t1\t177\tL\t1699225080\t\r\n" +
+		"Placebo\tMeds\tInfra-Red\t2\t196\tS\t1699225257\t\r\n" +
+		"Placebo\tMeds\tDrag\t3\t\tL\t1699225453\r\n"
+
+	reader, err := main.NewScrobbleReader(main.FormatScrobblerLog, strings.NewReader(input))
+	require.NoError(t, err)
+
+	scrobbles := readAllScrobbles(t, reader)
+	require.Len(t, scrobbles, 2)
+	require.Equal(t, []string{"Placebo"}, scrobbles[0].Artists)
+	require.Equal(t, "Meds", scrobbles[0].Track)
+	require.Equal(t, "Meds", scrobbles[0].Album)
+	require.Equal(t, 177*time.Second, scrobbles[0].Duration)
+	require.True(t, time.Unix(1699225080, 0).Equal(scrobbles[0].Timestamp))
+	require.Equal(t, "Drag", scrobbles[1].Track)
+	require.Equal(t, time.Duration(0), scrobbles[1].Duration)
+
+	reader, err = main.NewScrobbleReader(main.FormatScrobblerLog, strings.NewReader("Placebo\tMeds\n"))
+	require.NoError(t, err)
+	_, err = reader.Read()
+	require.ErrorContains(t, err, "line 1")
+}
+
+func TestScrobblerLogReaderUnknownTimezone(t *testing.T) {
+	location := time.Local
+	t.Cleanup(func() {
+		time.Local = location
+	})
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+
+	input := "#AUDIOSCROBBLER/1.1\n#TZ/UNKNOWN\nPlacebo\tMeds\tMeds\t1\t177\tL\t1699225080\t\n"
+
+	reader, err := main.NewScrobbleReader(main.FormatScrobblerLog, strings.NewReader(input))
+	require.NoError(t, err)
+
+	scrobbles := readAllScrobbles(t, reader)
+	require.Len(t, scrobbles, 1)
+	// the player clock was 2 hours ahead of UTC
+	require.True(t, time.Unix(1699225080, 0).Add(-2*time.Hour).Equal(scrobbles[0].Timestamp))
+}
+
+func TestJSONScrobbleReader(t *testing.T) {
+	for _, input := range []string{
+		`[{"artists": ["Placebo"], "track": "Meds"}, {"artists": ["Placebo"], "track": "Drag"}]`,
+		"{\"artists\": [\"Placebo\"], \"track\": \"Meds\"}\n{\"artists\": [\"Placebo\"], \"track\": \"Drag\"}\n",
+		"  \n[\n{\"artists\": [\"Placebo\"], \"track\": \"Meds\"},\n{\"artists\": [\"Placebo\"], \"track\": \"Drag\"}\n]\n",
+	} {
+		reader, err := main.NewScrobbleReader(main.FormatJSON, strings.NewReader(input))
+		require.NoError(t, err)
+
+		scrobbles := readAllScrobbles(t, reader)
+		require.Len(t, scrobbles, 2, input)
+		require.Equal(t, "Drag", scrobbles[1].Track)
+	}
+
+	reader, err := main.NewScrobbleReader(main.FormatJSON, strings.NewReader(""))
+	require.NoError(t, err)
+	require.Empty(t, readAllScrobbles(t, reader))
+
+	reader, err = main.NewScrobbleReader(main.FormatJSON, strings.NewReader(`[{"track": 1}]`))
+	require.NoError(t, err)
+	_, err = reader.Read()
+	require.ErrorContains(t, err, "entry 1")
+}
+
+func TestListenBrainzReader(t *testing.T) {
+	input := `[{
+		"listened_at": 1699225080,
+		"track_metadata": {
+			"artist_name": "Placebo, David Bowie",
+			"track_name": "Without You I'm Nothing",
+			"release_name": "A Place For Us To Dream",
+			"additional_info": {"duration_ms": 251000},
+			"mbid_mapping": {"recording_mbid": "5b1a5d5c-7b4f-4d8f-9a2e-7b7b5e0c6f1a"}
+		}
+	}]`
+
+	reader, err := main.NewScrobbleReader(main.FormatListenBrainz, strings.NewReader(input))
+	require.NoError(t, err)
+
+	scrobbles := readAllScrobbles(t, reader)
+	require.Len(t, scrobbles, 1)
+	require.Equal(t, defaultScrobble.Artists, scrobbles[0].Artists)
+	require.Equal(t, defaultScrobble.Duration, scrobbles[0].Duration)
+	require.True(t, defaultScrobble.Timestamp.Equal(scrobbles[0].Timestamp))
+	require.Equal(t, "5b1a5d5c-7b4f-4d8f-9a2e-7b7b5e0c6f1a", scrobbles[0].MBIDs.Recording)
+}
+
+func TestReadScrobbleBatches(t *testing.T) {
+	input := "Placebo\tMeds\tMeds\t1\t177\tL\t1699225080\t\n" +
+		"\tMeds\tUntitled\t2\t196\tL\t1699225257\t\n" +
+		"Placebo\tMeds\tDrag\t3\t193\tL\t1699225453\t\n" +
+		"Placebo\tMeds\tSpace Monkey\t4\t230\tL\t1699225646\t\n"
+
+	reader, err := main.NewScrobbleReader(main.FormatScrobblerLog, strings.NewReader(input))
+	require.NoError(t, err)
+
+	regexes := []main.ParsedRegexReplace{{
+		Match:   regexp.MustCompile(`^Space Monkey$`),
+		Replace: "Space Monkey (Remastered)",
+		Artist:  false,
+		Track:   true,
+		Album:   false,
+	}}
+
+	var batches [][]string
+	skipped, err := main.ReadScrobbleBatches(reader, regexes, 2, func(batch []main.Scrobble) error {
+		var tracks []string
+		for _, scrobble := range batch {
+			tracks = append(tracks, scrobble.Track)
+		}
+		batches = append(batches, tracks)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, skipped)
+	require.Equal(t, [][]string{{"Meds", "Drag"}, {"Space Monkey (Remastered)"}}, batches)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	//nolint:gosec
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ReadFormParams reads URL-encoded parameters from the query string and request body. Unlike
+// [http.Request.ParseForm], the body is parsed regardless of the Content-Type header, since some last.fm clients
+// do not set it.
+func ReadFormParams(r *http.Request) (url.Values, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, WebhookMaxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range r.URL.Query() {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+
+	return params, nil
+}
+
+// LastFmMaxBatchSize is the maximum number of scrobbles in a single track.scrobble request.
+const LastFmMaxBatchSize = 50
+
+// ScrobbleFromLastFmParams reads a single track from last.fm API parameters.
+//
+// https://www.last.fm/api/show/track.updateNowPlaying
+func ScrobbleFromLastFmParams(params url.Values) (Scrobble, error) {
+	return scrobbleFromLastFmParams(params, "")
+}
+
+// ScrobblesFromLastFmParams reads one or more tracks from last.fm API parameters. Batches use indexed parameter
+// names (`artist[0]`, `timestamp[0]`, ...).
+//
+// https://www.last.fm/api/show/track.scrobble
+func ScrobblesFromLastFmParams(params url.Values) ([]Scrobble, error) {
+	if !params.Has("artist[0]") {
+		scrobble, err := scrobbleFromLastFmParams(params, "")
+		if err != nil {
+			return nil, err
+		}
+		return []Scrobble{scrobble}, nil
+	}
+
+	var scrobbles []Scrobble
+	for i := 0; i < LastFmMaxBatchSize; i++ {
+		suffix := fmt.Sprintf("[%d]", i)
+		if !params.Has("artist" + suffix) {
+			break
+		}
+
+		scrobble, err := scrobbleFromLastFmParams(params, suffix)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %s", i, err.Error())
+		}
+		scrobbles = append(scrobbles, scrobble)
+	}
+
+	return scrobbles, nil
+}
+
+func scrobbleFromLastFmParams(params url.Values, suffix string) (Scrobble, error) {
+	artist := params.Get("artist" + suffix)
+	track := params.Get("track" + suffix)
+	if artist == "" || track == "" {
+		return Scrobble{}, errors.New("artist and track are required")
+	}
+
+	var duration time.Duration
+	if value := params.Get("duration" + suffix); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Scrobble{}, fmt.Errorf("invalid duration: %s", value)
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+
+	timestamp := time.Now()
+	if value := params.Get("timestamp" + suffix); value != "" {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return Scrobble{}, fmt.Errorf("invalid timestamp: %s", value)
+		}
+		timestamp = time.Unix(seconds, 0)
+	}
+
+	return Scrobble{
+		// FIXME: this does not work in some cases (e.g., "Tyler, the Creator")
+		Artists:   strings.Split(artist, ", "),
+		Track:     track,
+		Album:     params.Get("album" + suffix),
+		Duration:  duration,
+		Timestamp: timestamp,
+		MBIDs:     MBIDs{Recording: params.Get("mbid" + suffix), Release: "", Artists: nil},
+	}, nil
+}
+
+// LastFmSignature calculates the `api_sig` parameter for the given request parameters.
+//
+// https://www.last.fm/api/authspec#_8-signing-calls
+func LastFmSignature(params url.Values, secret string) string {
+	keys := slices.Sorted(maps.Keys(params))
+
+	var signature strings.Builder
+	for _, key := range keys {
+		switch key {
+		case "api_sig", "format", "callback":
+			continue
+		}
+		signature.WriteString(key)
+		signature.WriteString(params.Get(key))
+	}
+	signature.WriteString(secret)
+
+	//nolint:gosec
+	hash := md5.Sum([]byte(signature.String()))
+	return hex.EncodeToString(hash[:])
+}
+
+// https://www.last.fm/api/errorcodes
+const (
+	LastFmErrorInvalidMethod          = 3
+	LastFmErrorAuthenticationFailed   = 4
+	LastFmErrorInvalidParameters      = 6
+	LastFmErrorInvalidSessionKey      = 9
+	LastFmErrorInvalidAPIKey          = 10
+	LastFmErrorInvalidMethodSignature = 13
+)
+
+type LastFmAPIResponse struct {
+	XMLName    xml.Name              `xml:"lfm"`
+	Status     string                `xml:"status,attr"`
+	Error      *LastFmAPIError       `xml:"error,omitempty"`
+	NowPlaying *LastFmAPITrack       `xml:"nowplaying,omitempty"`
+	Scrobbles  *LastFmAPIScrobbles   `xml:"scrobbles,omitempty"`
+	Session    *LastFmAPISessionInfo `xml:"session,omitempty"`
+}
+
+type LastFmAPIError struct {
+	Code    int    `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+type LastFmAPITrack struct {
+	Track          string           `xml:"track"`
+	Artist         string           `xml:"artist"`
+	Album          string           `xml:"album"`
+	Timestamp      int64            `xml:"timestamp,omitempty"`
+	IgnoredMessage LastFmAPIIgnored `xml:"ignoredMessage"`
+}
+
+type LastFmAPIIgnored struct {
+	Code int `xml:"code,attr"`
+}
+
+type LastFmAPIScrobbles struct {
+	Accepted  int              `xml:"accepted,attr"`
+	Ignored   int              `xml:"ignored,attr"`
+	Scrobbles []LastFmAPITrack `xml:"scrobble"`
+}
+
+type LastFmAPISessionInfo struct {
+	Name       string `xml:"name"`
+	Key        string `xml:"key"`
+	Subscriber int    `xml:"subscriber"`
+}
+
+func LastFmTrack(scrobble Scrobble, withTimestamp bool) LastFmAPITrack {
+	track := LastFmAPITrack{
+		Track:          scrobble.Track,
+		Artist:         scrobble.JoinArtists(),
+		Album:          scrobble.Album,
+		Timestamp:      0,
+		IgnoredMessage: LastFmAPIIgnored{Code: 0},
+	}
+	if withTimestamp {
+		track.Timestamp = scrobble.Timestamp.Unix()
+	}
+	return track
+}
+
+//nolint:exhaustruct
+func LastFmNowPlayingResponse(scrobble Scrobble) LastFmAPIResponse {
+	track := LastFmTrack(scrobble, false)
+	return LastFmAPIResponse{Status: "ok", NowPlaying: &track}
+}
+
+//nolint:exhaustruct
+func LastFmScrobbleResponse(scrobbles []Scrobble) LastFmAPIResponse {
+	response := LastFmAPIResponse{
+		Status:    "ok",
+		Scrobbles: &LastFmAPIScrobbles{Accepted: len(scrobbles), Ignored: 0, Scrobbles: nil},
+	}
+	for _, scrobble := range scrobbles {
+		response.Scrobbles.Scrobbles = append(response.Scrobbles.Scrobbles, LastFmTrack(scrobble, true))
+	}
+	return response
+}
+
+func WriteLastFmResponse(w http.ResponseWriter, response LastFmAPIResponse) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	if response.Status != "ok" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		log.Error().Err(err).Msg("error writing last.fm API response")
+		return
+	}
+	if err := xml.NewEncoder(w).Encode(response); err != nil {
+		log.Error().Err(err).Msg("error writing last.fm API response")
+	}
+}
+
+//nolint:exhaustruct
+func LastFmSessionResponse(username, key string) LastFmAPIResponse {
+	return LastFmAPIResponse{
+		Status:  "ok",
+		Session: &LastFmAPISessionInfo{Name: username, Key: key, Subscriber: 0},
+	}
+}
+
+//nolint:exhaustruct
+func WriteLastFmError(w http.ResponseWriter, code int, message string) {
+	WriteLastFmResponse(w, LastFmAPIResponse{
+		Status: "failed",
+		Error:  &LastFmAPIError{Code: code, Message: message},
+	})
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"maps"
+	"os"
+	"os/signal"
+	"reflect"
 	"regexp"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -25,17 +30,171 @@ const (
 	RuneWarningSign          = '\u26A0'
 )
 
+// SeekTolerance is added to the time since the previous iteration when checking if the position of a new track is
+// plausible.
+const SeekTolerance = 3 * time.Second
+
+// MainLoop stores the configuration and state of the main loop.
+type MainLoop struct {
+	PlayerBlacklist     []*regexp.Regexp
+	ParsedRegexes       []ParsedRegexReplace
+	MissingMetadata     []MissingMetadataPolicy
+	Streams             []Stream
+	Sources             []Source
+	Sinks               []Sink
+	MinPlaybackDuration int
+	MinPlaybackPercent  int
+	NotifyOnScrobble    bool
+	NotifyOnError       bool
+	Notifier            NotifierFunc
+
+	// Corrections is nil unless learn_corrections is enabled.
+	Corrections *Corrections
+	// Deduplicator is nil if deduplication is disabled.
+	Deduplicator *Deduplicator
+	// MusicBrainz is nil unless metadata enrichment is enabled.
+	MusicBrainz *MusicBrainz
+	// ContentFilter is nil if content filtering is disabled.
+	ContentFilter *ContentFilter
+	// EventLog is nil unless event_log is set.
+	EventLog *EventLog
+	// Metrics is nil unless metrics_address is set.
+	Metrics *Metrics
+
+	PreviouslyPlaying map[string]PlaybackStatus
+	ScrobbledPrevious map[string]bool
+	// Blacklisted stores blacklisted players seen in the previous iteration, so blacklist hits are only added to
+	// the event log once.
+	Blacklisted map[string]bool
+	// Skipped stores the tracks skipped in the previous iteration (filtered or missing metadata), so they are only
+	// logged once.
+	Skipped map[string]PlaybackStatus
+	// RetryQueues stores scrobbles that were not saved yet, one queue per sink (same order as Sinks).
+	RetryQueues []*RetryQueue
+	// State is nil unless the player state is persisted (only done by `goscrobble run`).
+	State *DaemonState
+	// Clock detects suspends and wall clock changes between iterations.
+	Clock *ClockWatcher
+}
+
+func NewMainLoop(config Config, sources []Source, sinks []Sink, notifier NotifierFunc) *MainLoop {
+	var corrections *Corrections
+	if config.LearnCorrections {
+		var err error
+		corrections, err = LoadCorrections(CorrectionsFilename())
+		if err != nil {
+			log.Error().
+				Err(err).
+				Msg("error loading corrections, starting with an empty corrections file")
+			corrections = &Corrections{Filename: CorrectionsFilename(), Entries: []Correction{}}
+		}
+	}
+
+	var eventLog *EventLog
+	if config.EventLog != "" {
+		var err error
+		eventLog, err = OpenEventLog(config.EventLog)
+		if err != nil {
+			log.Error().
+				Str("filename", config.EventLog).
+				Err(err).
+				Msg("error opening event log, events will not be saved")
+		}
+	}
+
+	var metrics *Metrics
+	if config.MetricsAddress != "" {
+		metrics = NewMetrics()
+	}
+
+	var retryQueues []*RetryQueue
+	for _, sink := range sinks {
+		queue := NewRetryQueue(sink)
+		queue.Corrections = corrections
+		queue.EventLog = eventLog
+		queue.Metrics = metrics
+		retryQueues = append(retryQueues, queue)
+	}
+
+	return &MainLoop{
+		PlayerBlacklist:     CompilePlayerBlacklist(config.Blacklist),
+		ParsedRegexes:       config.ParseRegexes(),
+		MissingMetadata:     config.ParseMissingMetadataPolicies(),
+		Streams:             config.ParseStreams(),
+		Sources:             sources,
+		Sinks:               sinks,
+		MinPlaybackDuration: config.MinPlaybackDuration,
+		MinPlaybackPercent:  config.MinPlaybackPercent,
+		NotifyOnScrobble:    config.NotifyOnScrobble,
+		NotifyOnError:       config.NotifyOnError,
+		Notifier:            notifier,
+		Corrections:         corrections,
+		Deduplicator:        NewDeduplicator(config.Deduplication),
+		MusicBrainz:         NewMusicBrainz(config.MusicBrainz, MusicBrainzCacheFilename()),
+		ContentFilter:       NewContentFilter(config.ContentFilter),
+		EventLog:            eventLog,
+		Metrics:             metrics,
+		PreviouslyPlaying:   map[string]PlaybackStatus{},
+		ScrobbledPrevious:   map[string]bool{},
+		Blacklisted:         map[string]bool{},
+		Skipped:             map[string]PlaybackStatus{},
+		RetryQueues:         retryQueues,
+		State:               nil,
+		Clock:               NewClockWatcher(),
+	}
+}
+
 func RunMainLoop(config Config) {
 	log.Debug().Msg("starting main loop")
 
-	previouslyPlaying := map[string]PlaybackStatus{}
-	scrobbledPrevious := map[string]bool{}
+	setups := config.WorkingSinkSetups()
+	var sinks []Sink
+	for _, setup := range setups {
+		sinks = append(sinks, setup.Sink)
+	}
 
-	playerBlacklist := CompilePlayerBlacklist(config.Blacklist)
-	parsedRegexes := config.ParseRegexes()
+	loop := NewMainLoop(config, config.SetupSources(), sinks, SendNotification)
 
-	sources := config.SetupSources()
-	sinks := config.SetupSinks()
+	// scrobbles that were queued before a restart are sent again
+	for i, queue := range loop.RetryQueues {
+		queue.Filename = RetryQueueFilename(setups[i].Key)
+		if err := queue.Load(); err != nil {
+			log.Error().
+				Str("filename", queue.Filename).
+				Err(err).
+				Msg("error loading retry queue, queued scrobbles will not be sent")
+		}
+	}
+
+	state, err := LoadDaemonState(StateFilename())
+	if err != nil {
+		log.Error().
+			Str("filename", state.Filename).
+			Err(err).
+			Msg("error loading state, starting without restoring players")
+		state = &DaemonState{Filename: StateFilename(), Players: map[string]PlayerState{}, restorable: nil}
+	}
+	loop.State = state
+
+	// save the latest positions on shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	if loop.Metrics != nil {
+		if err := ServeMetrics(config.MetricsAddress, loop.Metrics); err != nil {
+			log.Error().
+				Str("address", config.MetricsAddress).
+				Err(err).
+				Msg("error starting metrics server")
+		}
+	}
+
+	sleeping, err := WatchSleep()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg("cannot watch for system sleep, relying on clock checks only")
+	}
 
 	ticker := time.NewTicker(time.Second * time.Duration(config.PollRate))
 
@@ -44,92 +203,210 @@ func RunMainLoop(config Config) {
 	}
 
 	for {
-		RunMainLoopOnce(
-			previouslyPlaying,
-			scrobbledPrevious,
-			playerBlacklist,
-			parsedRegexes,
-			sources,
-			sinks,
-			config.MinPlaybackDuration,
-			config.MinPlaybackPercent,
-			config.NotifyOnScrobble,
-			config.NotifyOnError,
-			SendNotification,
-		)
+		loop.RunOnce()
 
-		timestamp := <-ticker.C
-		log.Debug().
-			Time("timestamp", timestamp).
-			Msg("completed main loop iteration")
+		select {
+		case timestamp := <-ticker.C:
+			log.Debug().
+				Time("timestamp", timestamp).
+				Msg("completed main loop iteration")
+		case start, ok := <-sleeping:
+			switch {
+			case !ok:
+				sleeping = nil
+			case start:
+				log.Info().Msg("system is going to sleep")
+				if err := loop.State.Save(); err != nil {
+					log.Error().
+						Err(err).
+						Msg("error saving state")
+				}
+			default:
+				// run the next iteration immediately, the offset is detected by the clock check
+				log.Info().Msg("system resumed from sleep")
+			}
+		case received := <-signals:
+			log.Info().
+				Str("signal", received.String()).
+				Msg("shutting down")
+			if err := loop.State.Save(); err != nil {
+				log.Error().
+					Err(err).
+					Msg("error saving state")
+			}
+			return
+		}
 	}
 }
 
-func RunMainLoopOnce(
-	previouslyPlaying map[string]PlaybackStatus,
-	scrobbledPrevious map[string]bool,
-	playerBlacklist []*regexp.Regexp,
-	parsedRegexes []ParsedRegexReplace,
-	sources []Source,
-	sinks []Sink,
-	minPlaybackDuration int,
-	minPlaybackPercent int,
-	notifyOnScrobble bool,
-	notifyOnError bool,
-	notifier NotifierFunc,
-) {
+func (l *MainLoop) RunOnce() {
+	if offset := l.Clock.Check(); offset != 0 {
+		log.Info().
+			Dur("offset", offset).
+			Msg("detected suspend or wall clock change")
+		l.AdjustTimestamps(offset)
+	}
+
 	playbackStatus := make(map[string]PlaybackStatus)
+	blacklisted := make(map[string]bool)
+	// pushed stores the players of push-based sources, which are only scrobbled when the source reports a finished
+	// play, not when the minimum playback time is reached (otherwise the play would be scrobbled twice)
+	pushed := make(map[string]bool)
 
-	for _, source := range sources {
+	for _, source := range l.Sources {
+		start := time.Now()
 		status, err := source.GetInfo()
+		l.Metrics.ObserveSourcePoll(source.Name(), time.Since(start), err)
 		if err != nil {
 			log.Error().
 				Err(err).
 				Str("source", source.Name()).
 				Msg("error getting current playback status")
 		}
-		for player := range status {
-			if IsBlacklisted(playerBlacklist, player) {
+		for player, playerStatus := range status {
+			if IsBlacklisted(l.PlayerBlacklist, player) {
+				if !l.Blacklisted[player] {
+					l.EventLog.LogScrobble(EventBlacklisted, player, "", playerStatus.Scrobble, playerStatus.Scrobble, nil)
+				}
+				blacklisted[player] = true
 				delete(status, player)
 			}
 		}
 		maps.Copy(playbackStatus, status)
-	}
 
+		if scrobbleSource, ok := source.(ScrobbleSource); ok {
+			for player := range status {
+				pushed[player] = true
+			}
+			l.QueuePendingScrobbles(scrobbleSource)
+		}
+	}
+	l.Blacklisted = blacklisted
+	l.Metrics.SetActivePlayers(len(playbackStatus))
+
+	// scrobbles reported by the sources, before applying regexes and corrections
+	originals := make(map[string]Scrobble)
+	// enriched stores the scrobbles with learned corrections and the metadata from MusicBrainz. Tracks are compared
+	// without them, so a correction learned or a lookup finishing during playback does not start a new play.
+	enriched := make(map[string]Scrobble)
 	for player, status := range playbackStatus {
-		status.RegexReplace(parsedRegexes)
+		originals[player] = status.Scrobble
+		l.ParseStream(player, &status)
+		status.RegexReplace(l.ParsedRegexes)
 		playbackStatus[player] = status
+
+		scrobble := status.Scrobble
+		l.Corrections.Apply(&scrobble)
+		l.MusicBrainz.EnrichCached(&scrobble)
+		enriched[player] = scrobble
 	}
 
 	for player := range playbackStatus {
-		if _, ok := previouslyPlaying[player]; !ok {
+		if _, ok := l.PreviouslyPlaying[player]; !ok {
 			log.Info().
 				Str("player", player).
 				Msg("new player found")
-			previouslyPlaying[player] = PlaybackStatus{}
-			scrobbledPrevious[player] = false
+			l.EventLog.Log(Event{
+				Time:   time.Time{},
+				Type:   EventPlayerAppeared,
+				Player: player,
+				Sink:   "",
+				Before: nil,
+				After:  nil,
+				Error:  "",
+			})
+			l.PreviouslyPlaying[player] = PlaybackStatus{}
+			l.ScrobbledPrevious[player] = false
+
+			if saved, ok := l.State.Restore(player, playbackStatus[player]); ok {
+				log.Info().
+					Str("player", player).
+					Interface("status", saved.Status).
+					Bool("scrobbled", saved.Scrobbled).
+					Msg("restored player state")
+				l.PreviouslyPlaying[player] = saved.Status
+				l.ScrobbledPrevious[player] = saved.Scrobbled
+			}
 		}
 	}
 
-	for player := range previouslyPlaying {
+	for player := range l.PreviouslyPlaying {
 		if _, ok := playbackStatus[player]; !ok {
 			log.Info().
 				Str("player", player).
 				Msg("player disappeared")
-			delete(previouslyPlaying, player)
-			delete(scrobbledPrevious, player)
+			l.EventLog.Log(Event{
+				Time:   time.Time{},
+				Type:   EventPlayerDisappeared,
+				Player: player,
+				Sink:   "",
+				Before: nil,
+				After:  nil,
+				Error:  "",
+			})
+			delete(l.PreviouslyPlaying, player)
+			delete(l.ScrobbledPrevious, player)
 		}
 	}
 
+	// the deduplication only waits for players that are still playing the track
 	for player, status := range playbackStatus {
-		if !status.IsValid() {
+		if previous, ok := l.PreviouslyPlaying[player]; ok && previous.Track != "" {
+			previous.State = status.State
+			if !previous.Equals(status) {
+				previous.State = PlaybackStopped
+			}
+			l.PreviouslyPlaying[player] = previous
+		}
+	}
+
+	skipped := make(map[string]PlaybackStatus)
+	for player, status := range playbackStatus {
+		// players without a track (e.g., stopped players) are skipped silently
+		if status.JoinArtists() == "" && status.Track == "" {
+			continue
+		}
+
+		// the checks use the enriched metadata (e.g., an album filled in by MusicBrainz)
+		checked := enrichedStatus(status, enriched[player])
+
+		if reason, ok := l.CheckMetadata(player, checked.Scrobble); !ok {
+			if previous, ok := l.Skipped[player]; !ok || !previous.Equals(status) {
+				log.Info().
+					Str("player", player).
+					Interface("status", status).
+					Str("reason", reason).
+					Msg("skipping track with missing metadata")
+				l.EventLog.LogScrobble(
+					EventMissingMetadata,
+					player,
+					"",
+					originals[player],
+					checked.Scrobble,
+					errors.New(reason),
+				)
+			}
+			skipped[player] = status
+			continue
+		}
+
+		if reason, ok := l.ContentFilter.Match(checked); ok {
+			if previous, ok := l.Skipped[player]; !ok || !previous.Equals(status) {
+				log.Info().
+					Str("player", player).
+					Interface("status", status).
+					Str("reason", reason).
+					Msg("skipping filtered content")
+				l.EventLog.LogScrobble(EventFiltered, player, "", originals[player], checked.Scrobble, errors.New(reason))
+			}
+			skipped[player] = status
 			continue
 		}
 
 		minPlayTime, err := MinPlayTime(
 			status.Duration,
-			minPlaybackDuration,
-			minPlaybackPercent,
+			l.MinPlaybackDuration,
+			l.MinPlaybackPercent,
 		)
 		if err != nil {
 			log.Warn().
@@ -139,24 +416,37 @@ func RunMainLoopOnce(
 				Msg("cannot calculate minimum playback time")
 			continue
 		}
+		if status.Duration == 0 {
+			minPlayTime = l.MissingMetadataPolicy(player).DurationThreshold
+		}
+
+		original := originals[player]
 
-		if !status.Equals(previouslyPlaying[player]) && status.State == PlaybackPlaying {
+		if !status.Equals(l.PreviouslyPlaying[player]) && status.State == PlaybackPlaying {
+			status.Timestamp = l.StartTimestamp(player, status, time.Now())
 			status.Position = time.Duration(0)
-			status.Timestamp = time.Now()
+			original.Timestamp = status.Timestamp
+
+			l.PreviouslyPlaying[player] = status
+			l.ScrobbledPrevious[player] = false
 
-			previouslyPlaying[player] = status
-			scrobbledPrevious[player] = false
+			sent := enrichedStatus(status, enriched[player])
 
 			log.Debug().
 				Str("player", player).
-				Interface("status", status).
+				Interface("status", sent).
 				Msg("started playback of new track")
 
-			if notifyOnScrobble {
-				newID, err := notifier(
+			l.EventLog.LogScrobble(EventNewTrack, player, "", original, sent.Scrobble, nil)
+			if !reflect.DeepEqual(original, sent.Scrobble) {
+				l.EventLog.LogScrobble(EventRewritten, player, "", original, sent.Scrobble, nil)
+			}
+
+			if l.NotifyOnScrobble {
+				newID, err := l.Notifier(
 					nowPlayingNotificationID,
-					fmt.Sprintf("%c now playing: %s", RuneBeamedSixteenthNotes, status.Track),
-					fmt.Sprintf("%s %c %s", status.JoinArtists(), RuneEmDash, status.Album),
+					fmt.Sprintf("%c now playing: %s", RuneBeamedSixteenthNotes, sent.Track),
+					fmt.Sprintf("%s %c %s", sent.JoinArtists(), RuneEmDash, sent.Album),
 				)
 				if err != nil {
 					log.Error().
@@ -167,44 +457,196 @@ func RunMainLoopOnce(
 				}
 			}
 
-			for _, sink := range sinks {
-				SendNowPlaying(player, sink, status, notifyOnError, notifier)
+			for _, sink := range l.Sinks {
+				err := SendNowPlaying(player, sink, sent, l.NotifyOnError, l.Notifier)
+				l.Metrics.ObserveNowPlaying(sink.Name(), err)
+				if err != nil {
+					l.EventLog.LogScrobble(EventNowPlayingFailed, player, sink.Name(), original, sent.Scrobble, err)
+				} else {
+					l.EventLog.LogScrobble(EventNowPlayingSent, player, sink.Name(), original, sent.Scrobble, nil)
+				}
 			}
 
 			continue
 		}
 
-		status.Timestamp = previouslyPlaying[player].Timestamp
+		status.Timestamp = l.PreviouslyPlaying[player].Timestamp
+		original.Timestamp = status.Timestamp
 
-		if status.Position < minPlayTime || status.State != PlaybackPlaying || scrobbledPrevious[player] {
+		position := status.Position
+		if status.Duration == 0 && position == 0 {
+			// players without duration often do not report a position either
+			position = time.Since(status.Timestamp)
+		}
+
+		if position < minPlayTime || status.State != PlaybackPlaying || l.ScrobbledPrevious[player] || pushed[player] {
 			continue
 		}
 
-		log.Info().
+		if other, ok := l.Deduplicator.PreferredPlayer(player, status.Scrobble, l.PreviouslyPlaying); ok {
+			log.Debug().
+				Str("player", player).
+				Str("other_player", other).
+				Interface("status", status).
+				Msg("waiting for player with higher priority")
+			continue
+		}
+
+		l.ScrobbledPrevious[player] = true
+
+		sent := enrichedStatus(status, enriched[player])
+		l.EventLog.LogScrobble(EventThresholdReached, player, "", original, sent.Scrobble, nil)
+		l.QueueScrobble(player, original, sent)
+	}
+
+	l.Skipped = skipped
+
+	if l.State != nil {
+		players := make(map[string]PlayerState)
+		for player, status := range l.PreviouslyPlaying {
+			if status.Track == "" {
+				continue
+			}
+			status.Position = playbackStatus[player].Position
+			players[player] = PlayerState{Status: status, Scrobbled: l.ScrobbledPrevious[player]}
+		}
+		l.State.Update(players)
+	}
+
+	queueDepth := make(map[string]int)
+	for _, queue := range l.RetryQueues {
+		queue.Flush(l.NotifyOnError, l.Notifier)
+		queueDepth[queue.Sink.Name()] += len(queue.Scrobbles)
+	}
+	l.Metrics.SetQueueDepth(queueDepth)
+}
+
+// StartTimestamp returns the start of playback of a new track, calculated from the position reported by the player,
+// so scrobble timestamps match the history of the player if playback started before goscrobble saw the track (e.g.,
+// goscrobble was started during a song).
+//
+// If the player was already playing another track in the previous iteration, the new track cannot have played longer
+// than the time since then. A larger position means the user seeked, so the current time is used instead.
+func (l *MainLoop) StartTimestamp(player string, status PlaybackStatus, now time.Time) time.Time {
+	switch {
+	case status.Position <= 0 || status.Position > status.Duration:
+		return now
+	case l.PreviouslyPlaying[player].Track != "" && status.Position > l.Clock.Interval()+SeekTolerance:
+		log.Debug().
 			Str("player", player).
-			Interface("status", status).
-			Msg("scrobbling track")
+			Dur("position", status.Position).
+			Msg("position of new track is larger than the time since the previous iteration, ignoring seek")
+		return now
+	default:
+		return now.Add(-status.Position)
+	}
+}
 
-		if notifyOnScrobble {
-			if _, err := notifier(
-				uint32(0),
-				fmt.Sprintf("%c scrobbling: %s", RuneCheckMark, status.Track),
-				fmt.Sprintf("%s %c %s", status.JoinArtists(), RuneEmDash, status.Album),
-			); err != nil {
-				log.Error().
-					Err(err).
-					Msg("error sending desktop notification")
+// enrichedStatus returns the status with the metadata of the corrected and enriched scrobble, keeping the start of
+// playback.
+func enrichedStatus(status PlaybackStatus, enriched Scrobble) PlaybackStatus {
+	enriched.Timestamp = status.Timestamp
+	status.Scrobble = enriched
+	return status
+}
+
+// QueuePendingScrobbles adds finished plays received by a push-based source to the retry queues.
+func (l *MainLoop) QueuePendingScrobbles(source ScrobbleSource) {
+	for player, scrobbles := range source.PendingScrobbles() {
+		if IsBlacklisted(l.PlayerBlacklist, player) {
+			log.Debug().
+				Str("player", player).
+				Int("scrobbles", len(scrobbles)).
+				Msg("dropping pending scrobbles of blacklisted player")
+			for _, scrobble := range scrobbles {
+				l.EventLog.LogScrobble(EventBlacklisted, player, "", scrobble, scrobble, nil)
 			}
+			continue
 		}
 
-		scrobbledPrevious[player] = true
+		for _, scrobble := range scrobbles {
+			original := scrobble
+			scrobble.RegexReplace(l.ParsedRegexes)
+			l.Corrections.Apply(&scrobble)
+			l.MusicBrainz.EnrichCached(&scrobble)
+
+			if !reflect.DeepEqual(original, scrobble) {
+				l.EventLog.LogScrobble(EventRewritten, player, "", original, scrobble, nil)
+			}
+
+			status := PlaybackStatus{
+				Scrobble: scrobble,
+				State:    PlaybackStopped,
+				Position: scrobble.Duration,
+				Metadata: PlayerMetadata{},
+			}
+
+			if reason, ok := l.ContentFilter.Match(status); ok {
+				log.Info().
+					Str("player", player).
+					Interface("scrobble", scrobble).
+					Str("reason", reason).
+					Msg("dropping filtered pending scrobble")
+				l.EventLog.LogScrobble(EventFiltered, player, "", original, scrobble, errors.New(reason))
+				continue
+			}
+
+			if scrobble.JoinArtists() == "" || scrobble.Track == "" {
+				log.Warn().
+					Str("player", player).
+					Interface("scrobble", scrobble).
+					Msg("dropping pending scrobble without artist or track")
+				continue
+			}
 
-		for _, sink := range sinks {
-			SendScrobble(player, sink, status, notifyOnError, notifier)
+			l.QueueScrobble(player, original, status)
 		}
 	}
 }
 
+// QueueScrobble adds a scrobble to the retry queues of all sinks. The queues are flushed at the end of each loop
+// iteration.
+func (l *MainLoop) QueueScrobble(player string, original Scrobble, status PlaybackStatus) {
+	if other, ok := l.Deduplicator.IsDuplicate(player, status.Scrobble); ok {
+		log.Info().
+			Str("player", player).
+			Str("other_player", other).
+			Interface("status", status).
+			Msg("skipping duplicate scrobble")
+		l.EventLog.LogScrobble(
+			EventDuplicate,
+			player,
+			"",
+			original,
+			status.Scrobble,
+			fmt.Errorf("already scrobbled by %s", other),
+		)
+		return
+	}
+	l.Deduplicator.Add(player, status.Scrobble)
+
+	log.Info().
+		Str("player", player).
+		Interface("status", status).
+		Msg("scrobbling track")
+
+	if l.NotifyOnScrobble {
+		if _, err := l.Notifier(
+			uint32(0),
+			fmt.Sprintf("%c scrobbling: %s", RuneCheckMark, status.Track),
+			fmt.Sprintf("%s %c %s", status.JoinArtists(), RuneEmDash, status.Album),
+		); err != nil {
+			log.Error().
+				Err(err).
+				Msg("error sending desktop notification")
+		}
+	}
+
+	for _, queue := range l.RetryQueues {
+		queue.Add(player, original, status.Scrobble)
+	}
+}
+
 func CompilePlayerBlacklist(blacklist []string) []*regexp.Regexp {
 	var playerBlacklist []*regexp.Regexp
 
@@ -232,14 +674,15 @@ func SendNowPlaying(player string,
 	status PlaybackStatus,
 	notifyOnError bool,
 	notifier NotifierFunc,
-) {
+) error {
 	log.Debug().
 		Str("player", player).
 		Str("sink", sink.Name()).
 		Interface("status", status).
 		Msg("updating now playing status")
 
-	if err := sink.NowPlaying(status.Scrobble); err != nil {
+	err := sink.NowPlaying(status.Scrobble)
+	if err != nil {
 		log.Error().
 			Str("player", player).
 			Str("sink", sink.Name()).
@@ -265,6 +708,8 @@ func SendNowPlaying(player string,
 			Interface("status", status).
 			Msg("updated now playing status")
 	}
+
+	return err
 }
 
 func SendScrobble(player string,
@@ -272,14 +717,15 @@ func SendScrobble(player string,
 	status PlaybackStatus,
 	notifyOnError bool,
 	notifier NotifierFunc,
-) {
+) error {
 	log.Debug().
 		Str("player", player).
 		Str("sink", sink.Name()).
 		Interface("status", status).
 		Msg("saving scrobble")
 
-	if err := sink.Scrobble(status.Scrobble); err != nil {
+	err := sink.Scrobble(status.Scrobble)
+	if err != nil {
 		log.Error().
 			Str("player", player).
 			Str("sink", sink.Name()).
@@ -305,6 +751,8 @@ func SendScrobble(player string,
 			Interface("status", status).
 			Msg("saved scrobble")
 	}
+
+	return err
 }
 
 func MinPlayTime(
@@ -1,7 +1,11 @@
 package main_test
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"regexp"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,12 +14,6 @@ import (
 )
 
 func TestMainLoop(t *testing.T) {
-	previouslyPlaying := map[string]main.PlaybackStatus{}
-	scrobbledPrevious := map[string]bool{}
-
-	playerBlacklist := []*regexp.Regexp{}
-	parsedRegexes := []main.ParsedRegexReplace{}
-
 	fakeSource := &FakeSource{
 		PlayerName:     "",
 		Empty:          true,
@@ -27,29 +25,13 @@ func TestMainLoop(t *testing.T) {
 	fakeSink := &FakeSink{}
 	sinks := []main.Sink{fakeSink}
 
-	minPlaybackDuration := 4 * 60
-	minPlaybackPercent := 50
-
-	notifyOnScrobble := true
-	notifyOnError := true
-
 	fakeNotifier := FakeNotifier{}
 
-	runLoop := func() {
-		main.RunMainLoopOnce(
-			previouslyPlaying,
-			scrobbledPrevious,
-			playerBlacklist,
-			parsedRegexes,
-			sources,
-			sinks,
-			minPlaybackDuration,
-			minPlaybackPercent,
-			notifyOnScrobble,
-			notifyOnError,
-			fakeNotifier.SendNotification,
-		)
-	}
+	loop := main.NewMainLoop(main.DefaultConfig, sources, sinks, fakeNotifier.SendNotification)
+	loop.NotifyOnScrobble = true
+	loop.NotifyOnError = true
+
+	runLoop := loop.RunOnce
 
 	runLoop()
 	require.Len(t, fakeSink.NowPlayingLog, 0)
@@ -86,9 +68,11 @@ func TestMainLoop(t *testing.T) {
 			Album:     "Without You I'm Nothing",
 			Duration:  time.Duration(time.Minute*3 + time.Second*34),
 			Timestamp: defaultPlaybackStatus.Timestamp.Add(defaultPlaybackStatus.Duration),
+			MBIDs:     main.MBIDs{},
 		},
 		State:    main.PlaybackPlaying,
 		Position: time.Duration(0),
+		Metadata: main.PlayerMetadata{},
 	}
 
 	fakeSource.PlaybackStatus = newPlaybackStatus
@@ -131,11 +115,30 @@ func TestMainLoop(t *testing.T) {
 }
 
 func TestMainLoopRegexes(t *testing.T) {
-	previouslyPlaying := map[string]main.PlaybackStatus{}
-	scrobbledPrevious := map[string]bool{}
+	fakeSource1 := &FakeSource{
+		PlayerName:     "fake player 1",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource2 := &FakeSource{
+		PlayerName:     "fake player 2",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	sources := []main.Source{fakeSource1, fakeSource2}
+
+	fakeSink := &FakeSink{}
+	sinks := []main.Sink{fakeSink}
+
+	fakeNotifier := FakeNotifier{}
 
-	playerBlacklist := []*regexp.Regexp{regexp.MustCompile("player 1")}
-	parsedRegexes := []main.ParsedRegexReplace{{
+	loop := main.NewMainLoop(main.DefaultConfig, sources, sinks, fakeNotifier.SendNotification)
+	loop.NotifyOnScrobble = true
+	loop.NotifyOnError = true
+	loop.PlayerBlacklist = []*regexp.Regexp{regexp.MustCompile("player 1")}
+	loop.ParsedRegexes = []main.ParsedRegexReplace{{
 		Match:   regexp.MustCompile("^Placebo$"),
 		Replace: "PLACEBO",
 		Artist:  true,
@@ -143,6 +146,15 @@ func TestMainLoopRegexes(t *testing.T) {
 		Album:   false,
 	}}
 
+	runLoop := loop.RunOnce
+
+	require.Len(t, fakeSink.NowPlayingLog, 0)
+	runLoop()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Equal(t, "PLACEBO", fakeSink.NowPlayingLog[0].Artists[0])
+}
+
+func TestMainLoopDeduplication(t *testing.T) {
 	fakeSource1 := &FakeSource{
 		PlayerName:     "fake player 1",
 		Empty:          false,
@@ -160,34 +172,239 @@ func TestMainLoopRegexes(t *testing.T) {
 	fakeSink := &FakeSink{}
 	sinks := []main.Sink{fakeSink}
 
-	minPlaybackDuration := 4 * 60
-	minPlaybackPercent := 50
+	fakeNotifier := FakeNotifier{}
+
+	config := main.DefaultConfig
+	config.Deduplication.SourcePriority = []string{"player 2$"}
+
+	loop := main.NewMainLoop(config, sources, sinks, fakeNotifier.SendNotification)
+	runLoop := loop.RunOnce
+
+	runLoop()
+	require.Len(t, fakeSink.NowPlayingLog, 2)
+
+	// player 2 has a higher priority and is still playing the same track
+	fakeSource1.PlaybackStatus.Position = time.Duration(time.Second * 200)
+
+	runLoop()
+	require.Len(t, fakeSink.ScrobbleLog, 0)
+
+	fakeSource2.PlaybackStatus.Position = time.Duration(time.Second * 200)
+
+	runLoop()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+
+	// without priority, the first scrobble wins
+	fakeSink.ScrobbleLog = nil
+	runLoop = main.NewMainLoop(main.DefaultConfig, sources, sinks, fakeNotifier.SendNotification).RunOnce
+
+	runLoop()
+	runLoop()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+
+	fakeSink.ScrobbleLog = nil
+	config.Deduplication.Enabled = false
+	runLoop = main.NewMainLoop(config, sources, sinks, fakeNotifier.SendNotification).RunOnce
+
+	runLoop()
+	runLoop()
+	require.Len(t, fakeSink.ScrobbleLog, 2)
+}
 
-	notifyOnScrobble := true
-	notifyOnError := true
+func TestMainLoopMusicBrainz(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(musicBrainzResponse))
+	}))
+	defer server.Close()
 
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	// the artist credit is replaced by MusicBrainz
+	fakeSource.PlaybackStatus.Artists = []string{"placebo, david bowie"}
+	fakeSource.PlaybackStatus.Position = 10 * time.Second
+
+	fakeSink := &FakeSink{}
 	fakeNotifier := FakeNotifier{}
 
-	runLoop := func() {
-		main.RunMainLoopOnce(
-			previouslyPlaying,
-			scrobbledPrevious,
-			playerBlacklist,
-			parsedRegexes,
-			sources,
-			sinks,
-			minPlaybackDuration,
-			minPlaybackPercent,
-			notifyOnScrobble,
-			notifyOnError,
-			fakeNotifier.SendNotification,
-		)
+	loop := main.NewMainLoop(
+		main.DefaultConfig,
+		[]main.Source{fakeSource},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	)
+	config := main.MusicBrainzConfig{Enabled: true, BaseURL: server.URL, Fields: main.MusicBrainzFields, MinScore: 0}
+	loop.MusicBrainz = main.NewMusicBrainz(config, filepath.Join(t.TempDir(), main.MusicBrainzCacheFileName))
+	loop.MusicBrainz.RetryInterval = 0
+
+	start := time.Now()
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Equal(t, []string{"placebo, david bowie"}, fakeSink.NowPlayingLog[0].Artists)
+	// the track is looked up in the background
+	require.Less(t, time.Since(start), main.MusicBrainzRequestInterval)
+
+	// the first lookup fails, the track is enriched after a later lookup succeeds during playback
+	require.Eventually(t, func() bool {
+		loop.RunOnce()
+		scrobble := fakeSource.PlaybackStatus.Scrobble
+		loop.MusicBrainz.EnrichCached(&scrobble)
+		return scrobble.MBIDs.Recording != ""
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(2), requests.Load())
+
+	// the enriched track is not a new play
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	fakeSource.PlaybackStatus.Position = 200 * time.Second
+	loop.RunOnce()
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+	require.Equal(t, defaultScrobble.Artists, fakeSink.ScrobbleLog[0].Artists)
+	require.Equal(t, "recording-id", fakeSink.ScrobbleLog[0].MBIDs.Recording)
+	// the start of playback was kept
+	require.WithinDuration(t, start.Add(-10*time.Second), fakeSink.ScrobbleLog[0].Timestamp, time.Second)
+}
+
+func TestMainLoopLearnCorrections(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
 	}
+	fakeSink := &FakeBatchSink{}
+	fakeSink.Correct = map[string]string{defaultScrobble.Track: "Without You Im Nothing"}
+	fakeNotifier := FakeNotifier{}
 
-	require.Len(t, fakeSink.NowPlayingLog, 0)
-	runLoop()
+	config := main.DefaultConfig
+	config.LearnCorrections = true
+
+	loop := main.NewMainLoop(config, []main.Source{fakeSource}, []main.Sink{fakeSink}, fakeNotifier.SendNotification)
+
+	loop.RunOnce()
 	require.Len(t, fakeSink.NowPlayingLog, 1)
-	require.Equal(t, "PLACEBO", fakeSink.NowPlayingLog[0].Artists[0])
+
+	// the correction is learned when the scrobble is sent
+	fakeSource.PlaybackStatus.Position = 200 * time.Second
+	loop.RunOnce()
+	require.Len(t, fakeSink.BatchLog, 1)
+	require.Len(t, loop.Corrections.Entries, 1)
+
+	// the corrected track is not a new play
+	fakeSource.PlaybackStatus.Position = 201 * time.Second
+	loop.RunOnce()
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Len(t, fakeSink.BatchLog, 1)
+
+	// the correction is used for the next play
+	fakeSource.Empty = true
+	loop.RunOnce()
+	fakeSource.Empty = false
+	fakeSource.PlaybackStatus.Position = 0
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 2)
+	require.Equal(t, "Without You Im Nothing", fakeSink.NowPlayingLog[1].Track)
+}
+
+func TestMainLoopDeduplicationPaused(t *testing.T) {
+	fakeSource1 := &FakeSource{
+		PlayerName:     "fake player 1",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource2 := &FakeSource{
+		PlayerName:     "fake player 2",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource1.PlaybackStatus.Position = 10 * time.Second
+	fakeSource2.PlaybackStatus.Position = 10 * time.Second
+
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+
+	config := main.DefaultConfig
+	config.Deduplication.SourcePriority = []string{"player 2$"}
+
+	loop := main.NewMainLoop(
+		config,
+		[]main.Source{fakeSource1, fakeSource2},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	)
+
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 2)
+
+	// player 2 has a higher priority and is still playing
+	fakeSource1.PlaybackStatus.Position = 200 * time.Second
+	loop.RunOnce()
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	// player 2 was paused before reaching the minimum playback time, player 1 is scrobbled instead
+	fakeSource2.PlaybackStatus.State = main.PlaybackPaused
+	loop.RunOnce()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+
+	// player 2 resumes, but the track was already scrobbled
+	fakeSource2.PlaybackStatus.State = main.PlaybackPlaying
+	fakeSource2.PlaybackStatus.Position = 200 * time.Second
+	loop.RunOnce()
+	loop.RunOnce()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+}
+
+func TestMainLoopStartTimestamp(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	loop := main.NewMainLoop(main.DefaultConfig, []main.Source{fakeSource}, []main.Sink{}, nil)
+
+	// goscrobble was started during the song
+	before := time.Now()
+	loop.RunOnce()
+	timestamp := loop.PreviouslyPlaying["fake player"].Timestamp
+	require.False(t, timestamp.Before(before.Add(-defaultPlaybackStatus.Position)))
+	require.False(t, timestamp.After(time.Now().Add(-defaultPlaybackStatus.Position)))
+
+	now := time.Now()
+	status := defaultPlaybackStatus
+	status.Track = "Pure Morning"
+
+	// the track changed between two iterations
+	status.Position = time.Second
+	require.Equal(t, now.Add(-time.Second), loop.StartTimestamp("fake player", status, now))
+
+	// the user seeked
+	status.Position = time.Minute
+	require.Equal(t, now, loop.StartTimestamp("fake player", status, now))
+	require.Equal(t, now.Add(-time.Minute), loop.StartTimestamp("other player", status, now))
+
+	// invalid positions
+	status.Position = status.Duration + time.Second
+	require.Equal(t, now, loop.StartTimestamp("other player", status, now))
+	status.Position = 0
+	require.Equal(t, now, loop.StartTimestamp("other player", status, now))
 }
 
 func TestCompilePlayerBlacklist(t *testing.T) {
@@ -202,25 +419,27 @@ func TestSendNowPlaying(t *testing.T) {
 	fakeSink := FakeSink{}
 	fakeNotifier := FakeNotifier{}
 
-	main.SendNowPlaying(
+	err := main.SendNowPlaying(
 		"fake player",
 		&fakeSink,
 		defaultPlaybackStatus,
 		true,
 		fakeNotifier.SendNotification,
 	)
+	require.NoError(t, err)
 	require.Len(t, fakeSink.NowPlayingLog, 1)
 	require.Equal(t, 0, fakeNotifier.Notifications)
 
 	fakeSink.Error = true
 
-	main.SendNowPlaying(
+	err = main.SendNowPlaying(
 		"fake player",
 		&fakeSink,
 		defaultPlaybackStatus,
 		true,
 		fakeNotifier.SendNotification,
 	)
+	require.Error(t, err)
 	require.Len(t, fakeSink.NowPlayingLog, 1)
 	require.Equal(t, 1, fakeNotifier.Notifications)
 }
@@ -229,25 +448,27 @@ func TestSendScrobble(t *testing.T) {
 	fakeSink := FakeSink{}
 	fakeNotifier := FakeNotifier{}
 
-	main.SendScrobble(
+	err := main.SendScrobble(
 		"fake player",
 		&fakeSink,
 		defaultPlaybackStatus,
 		true,
 		fakeNotifier.SendNotification,
 	)
+	require.NoError(t, err)
 	require.Len(t, fakeSink.ScrobbleLog, 1)
 	require.Equal(t, 0, fakeNotifier.Notifications)
 
 	fakeSink.Error = true
 
-	main.SendScrobble(
+	err = main.SendScrobble(
 		"fake player",
 		&fakeSink,
 		defaultPlaybackStatus,
 		true,
 		fakeNotifier.SendNotification,
 	)
+	require.Error(t, err)
 	require.Len(t, fakeSink.ScrobbleLog, 1)
 	require.Equal(t, 1, fakeNotifier.Notifications)
 }
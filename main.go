@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	lastfm "github.com/p-mng/lastfm-go"
 	"github.com/rodaine/table"
 	"github.com/rs/zerolog"
@@ -21,6 +24,9 @@ type ContextKey int
 
 const ContextConfigKey ContextKey = iota
 
+// TimestampLayouts are accepted by timestamp flags, which are parsed in the local timezone.
+var TimestampLayouts = []string{time.DateTime, "2006-01-02 15:04", time.RFC3339}
+
 func main() {
 	cmd := &cli.Command{
 		Name:  "goscrobble",
@@ -41,11 +47,21 @@ func main() {
 				Aliases: []string{"c"},
 				Usage:   "use a different configuration file",
 			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "merge the `[profiles.<name>]` sections of the config files",
+			},
 		},
 		Commands: []*cli.Command{
 			{
-				Name:   "run",
-				Usage:  "Watch sources and send scrobbles to configured sinks",
+				Name:  "run",
+				Usage: "Watch sources and send scrobbles to configured sinks",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: "refuse to start if the config file contains unknown keys or invalid values",
+					},
+				},
 				Action: ActionRun,
 			},
 			{
@@ -64,6 +80,7 @@ func main() {
 						Value:       time.Now().Add(-14 * 24 * time.Hour),
 						DefaultText: "current datetime minus 14 days",
 						Usage:       "only display scrobbles after this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
 					},
 					&cli.TimestampFlag{
 						Name:        "to",
@@ -71,18 +88,254 @@ func main() {
 						Value:       time.Now(),
 						DefaultText: "current datetime",
 						Usage:       "only display scrobbles before this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
 					},
 				},
 				Arguments: []cli.Argument{
 					&cli.StringArg{Name: "sink"},
 				},
 				Action: ActionScrobbles,
+				Commands: []*cli.Command{
+					{
+						Name:  "rm",
+						Usage: "Delete scrobbles by timestamp, or select them interactively if no timestamp is given",
+						Arguments: []cli.Argument{
+							&cli.StringArg{Name: "sink"},
+							&cli.StringArgs{Name: "timestamps", Min: 0, Max: -1},
+						},
+						Action: ActionScrobblesRemove,
+					},
+					{
+						Name:  "edit",
+						Usage: "Edit a scrobble by timestamp, or select it interactively if no timestamp is given",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:    "artist",
+								Aliases: []string{"a"},
+								Usage:   "new track artist (can be repeated)",
+							},
+							&cli.StringFlag{
+								Name:  "track",
+								Usage: "new track title",
+							},
+							&cli.StringFlag{
+								Name:  "album",
+								Usage: "new album name",
+							},
+							&cli.StringFlag{
+								Name:  "duration",
+								Usage: "new track duration (e.g., `3:45`)",
+							},
+						},
+						Arguments: []cli.Argument{
+							&cli.StringArg{Name: "sink"},
+							&cli.StringArg{Name: "timestamp"},
+						},
+						Action: ActionScrobblesEdit,
+					},
+				},
 			},
 			{
-				Name:   "check-config",
-				Usage:  "Check the config file, creating it if needed",
+				Name:  "scrobble",
+				Usage: "Manually scrobble a track or an album (e.g., a vinyl record) to all sinks or a chosen one",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "artist",
+						Aliases: []string{"a"},
+						Usage:   "artist of the track (can be used multiple times)",
+					},
+					&cli.StringFlag{
+						Name:    "track",
+						Aliases: []string{"t"},
+						Usage:   "track name",
+					},
+					&cli.StringFlag{
+						Name:  "album",
+						Usage: "album name",
+					},
+					&cli.StringFlag{
+						Name:  "duration",
+						Usage: "track duration (e.g., 3:45 or 225)",
+					},
+					&cli.TimestampFlag{
+						Name:        "at",
+						DefaultText: "playback ended now",
+						Usage:       "start of playback (of the first track if --album-file is used)",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
+					},
+					&cli.StringFlag{
+						Name:    "album-file",
+						Aliases: []string{"f"},
+						Usage:   "scrobble all tracks of a TOML/JSON tracklist back-to-back",
+					},
+					&cli.StringFlag{
+						Name:    "sink",
+						Aliases: []string{"s"},
+						Usage:   "only send scrobbles to this sink (key or name, e.g., `csv.default`)",
+					},
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"n"},
+						Usage:   "print the scrobbles without sending them",
+					},
+				},
+				Action: ActionScrobble,
+			},
+			{
+				Name:  "sync",
+				Usage: "Compare the scrobbles of two sinks and send missing scrobbles to the target sink",
+				Flags: []cli.Flag{
+					&cli.TimestampFlag{
+						Name:        "since",
+						Aliases:     []string{"s"},
+						Value:       time.Now().Add(-14 * 24 * time.Hour),
+						DefaultText: "current datetime minus 14 days",
+						Usage:       "only compare scrobbles after this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
+					},
+					&cli.TimestampFlag{
+						Name:        "until",
+						Aliases:     []string{"u"},
+						Value:       time.Now(),
+						DefaultText: "current datetime",
+						Usage:       "only compare scrobbles before this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
+					},
+					&cli.DurationFlag{
+						Name:  "tolerance",
+						Value: DefaultSyncTolerance,
+						Usage: "maximum timestamp difference of matching scrobbles",
+					},
+					&cli.BoolFlag{
+						Name:  "apply",
+						Usage: "send the scrobbles missing in the target sink (only print the differences otherwise)",
+					},
+				},
+				Arguments: []cli.Argument{
+					&cli.StringArg{Name: "from"},
+					&cli.StringArg{Name: "to"},
+				},
+				Action: ActionSync,
+			},
+			{
+				Name:  "export",
+				Usage: "Write the scrobbles of the given sink to a file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "format",
+						DefaultText: "detected from the file extension, or json",
+						Usage:       "output format (" + strings.Join(Formats, ", ") + ")",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "write to this file instead of the standard output",
+					},
+					&cli.TimestampFlag{
+						Name:        "since",
+						Aliases:     []string{"s"},
+						DefaultText: "all scrobbles",
+						Usage:       "only export scrobbles after this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
+					},
+					&cli.TimestampFlag{
+						Name:        "until",
+						Aliases:     []string{"u"},
+						Value:       time.Now(),
+						DefaultText: "current datetime",
+						Usage:       "only export scrobbles before this time",
+						Config:      cli.TimestampConfig{Timezone: time.Local, Layouts: TimestampLayouts},
+					},
+				},
+				Arguments: []cli.Argument{
+					&cli.StringArg{Name: "sink"},
+				},
+				Action: ActionExport,
+			},
+			{
+				Name:  "import",
+				Usage: "Send scrobbles read from a file (or `-` for the standard input) to configured sinks",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "format",
+						DefaultText: "detected from the file extension, or json",
+						Usage:       "input format (" + strings.Join(Formats, ", ") + ")",
+					},
+					&cli.StringFlag{
+						Name:    "sink",
+						Aliases: []string{"s"},
+						Usage:   "only send scrobbles to this sink (key or name, e.g., `csv.default`)",
+					},
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"n"},
+						Usage:   "print the scrobbles without sending them",
+					},
+				},
+				Arguments: []cli.Argument{
+					&cli.StringArg{Name: "file"},
+				},
+				Action: ActionImport,
+			},
+			{
+				Name:  "events",
+				Usage: "Print the event log",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "follow",
+						Aliases: []string{"f"},
+						Usage:   "wait for new events",
+					},
+					&cli.StringSliceFlag{
+						Name:    "type",
+						Aliases: []string{"t"},
+						Usage:   "only display events of this type (can be used multiple times)",
+					},
+					&cli.StringFlag{
+						Name:    "player",
+						Aliases: []string{"p"},
+						Usage:   "only display events of players containing this string",
+					},
+					&cli.TimestampFlag{
+						Name:    "since",
+						Aliases: []string{"s"},
+						Usage:   "only display events after this time",
+						Config: cli.TimestampConfig{
+							Timezone: time.Local,
+							Layouts:  []string{time.DateTime, time.DateOnly, time.RFC3339},
+						},
+					},
+					&cli.IntFlag{
+						Name:    "limit",
+						Aliases: []string{"l"},
+						Value:   0,
+						Usage:   "only display the last n events (0 displays all events)",
+					},
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "print events in JSON format",
+					},
+				},
+				Action: ActionEvents,
+			},
+			{
+				Name:  "check-config",
+				Usage: "Check the config file for unknown keys and invalid values, creating it if needed",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "print",
+						Aliases: []string{"p"},
+						Usage:   "print the effective config after merging included files and the profile",
+					},
+				},
 				Action: ActionCheckConfig,
 			},
+			{
+				Name:   "doctor",
+				Usage:  "Check all configured sources and sinks, exiting with a non-zero status on failure",
+				Action: ActionDoctor,
+			},
 			{
 				Name:   "list-sources",
 				Usage:  "Print all configured sources",
@@ -95,8 +348,14 @@ func main() {
 			},
 			{
 				Name:   "lastfm-auth",
-				Usage:  "Authenticate last.fm and save session key and username",
+				Usage:  "Authenticate last.fm and save session key and username to the credentials file",
 				Action: ActionLastFmAuth,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "keyring",
+						Usage: "save the session key to the Secret Service keyring instead of the credentials file",
+					},
+				},
 				Arguments: []cli.Argument{
 					&cli.StringArg{Name: "key"},
 				},
@@ -106,21 +365,34 @@ func main() {
 
 	cmd.Before = func(ctx context.Context, _ *cli.Command) (context.Context, error) {
 		SetupLogger(cmd)
-
-		filename := ConfigFilename(cmd)
-		config, err := ReadConfig(filename)
-		if err != nil {
-			return ctx, fmt.Errorf("cannot read config file: %s", err.Error())
-		}
-
-		ctx = context.WithValue(ctx, ContextConfigKey, config)
-
 		return ctx, nil
 	}
 
+	// the config is read by subcommands, since their flags are not parsed yet in the root command's Before
+	for _, subcommand := range cmd.Commands {
+		subcommand.Before = BeforeReadConfig
+	}
+
 	if err := cmd.Run(context.Background(), os.Args); err != nil {
 		fmt.Println("Error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+// BeforeReadConfig reads the config file and stores it in the context. `check-config` and `run --strict` use strict
+// validation.
+func BeforeReadConfig(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	filename := ConfigFilename(cmd)
+
+	config, err := LoadConfig(filename, ConfigOptions{
+		Strict:  cmd.Name == "check-config" || (cmd.Name == "run" && cmd.Bool("strict")),
+		Profile: cmd.String("profile"),
+	})
+	if err != nil {
+		return ctx, fmt.Errorf("cannot read config file: %s", err.Error())
 	}
+
+	return context.WithValue(ctx, ContextConfigKey, config), nil
 }
 
 func ActionRun(ctx context.Context, _ *cli.Command) error {
@@ -170,10 +442,565 @@ func ActionScrobbles(ctx context.Context, cmd *cli.Command) error {
 	return nil
 }
 
-func ActionCheckConfig(ctx context.Context, _ *cli.Command) error {
+func ActionScrobblesRemove(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	sink, err := config.SelectEditSink(cmd.StringArg("sink"))
+	if err != nil {
+		return err
+	}
+
+	input := bufio.NewScanner(os.Stdin)
+
+	var timestamps []time.Time
+	if values := cmd.StringArgs("timestamps"); len(values) > 0 {
+		for _, value := range values {
+			timestamp, err := ParseScrobbleTimestamp(value)
+			if err != nil {
+				return err
+			}
+			timestamps = append(timestamps, timestamp)
+		}
+	} else {
+		scrobbles, err := PromptScrobbles(cmd, sink, input, "Scrobbles to delete (e.g., 1,3-5): ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Delete %d scrobbles? [y/N] ", len(scrobbles))
+		input.Scan()
+		if strings.ToLower(strings.TrimSpace(input.Text())) != "y" {
+			return errors.New("aborted")
+		}
+
+		for _, s := range scrobbles {
+			timestamps = append(timestamps, s.Timestamp)
+		}
+	}
+
+	deleted, err := sink.DeleteScrobbles(timestamps)
+	if err != nil {
+		return fmt.Errorf("error deleting scrobbles: %s", err.Error())
+	}
+	if deleted == 0 {
+		return errors.New("no scrobbles found with the given timestamps")
+	}
+
+	fmt.Println("Deleted scrobbles:", deleted)
+	return nil
+}
+
+func ActionScrobblesEdit(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	if !cmd.IsSet("artist") && !cmd.IsSet("track") && !cmd.IsSet("album") && !cmd.IsSet("duration") {
+		return errors.New("no changes provided (use --artist, --track, --album, or --duration)")
+	}
+
+	sink, err := config.SelectEditSink(cmd.StringArg("sink"))
+	if err != nil {
+		return err
+	}
+
+	var scrobble Scrobble
+	if value := cmd.StringArg("timestamp"); value != "" {
+		timestamp, err := ParseScrobbleTimestamp(value)
+		if err != nil {
+			return err
+		}
+
+		scrobbles, err := sink.GetScrobbles(1, timestamp, timestamp)
+		if err != nil {
+			return fmt.Errorf("error fetching scrobbles: %s", err.Error())
+		}
+		if len(scrobbles) == 0 {
+			return errors.New("no scrobble found with the given timestamp")
+		}
+		scrobble = scrobbles[0]
+	} else {
+		scrobbles, err := PromptScrobbles(cmd, sink, bufio.NewScanner(os.Stdin), "Scrobble to edit: ")
+		if err != nil {
+			return err
+		}
+		if len(scrobbles) != 1 {
+			return errors.New("select a single scrobble to edit")
+		}
+		scrobble = scrobbles[0]
+	}
+
+	if cmd.IsSet("artist") {
+		scrobble.Artists = cmd.StringSlice("artist")
+	}
+	if cmd.IsSet("track") {
+		scrobble.Track = cmd.String("track")
+	}
+	if cmd.IsSet("album") {
+		scrobble.Album = cmd.String("album")
+	}
+	if cmd.IsSet("duration") {
+		if scrobble.Duration, err = ParseTrackDuration(cmd.String("duration")); err != nil {
+			return err
+		}
+	}
+	if scrobble.JoinArtists() == "" || scrobble.Track == "" {
+		return errors.New("artist and track cannot be empty")
+	}
+
+	edited, err := sink.EditScrobble(scrobble)
+	if err != nil {
+		return fmt.Errorf("error editing scrobble: %s", err.Error())
+	}
+	if edited == 0 {
+		return errors.New("no scrobble found with the given timestamp")
+	}
+
+	tbl := table.New("ARTISTS", "TRACK", "ALBUM", "DURATION", "TIMESTAMP")
+	tbl.AddRow(
+		scrobble.JoinArtists(),
+		scrobble.Track,
+		scrobble.Album,
+		scrobble.PrettyDuration(),
+		scrobble.Timestamp.Format(time.RFC1123),
+	)
+	tbl.Print()
+
+	return nil
+}
+
+// PromptScrobbles prints the scrobbles selected using the `scrobbles` flags (limit, from, and to) as a numbered
+// table and reads the selected rows from input.
+func PromptScrobbles(cmd *cli.Command, sink Sink, input *bufio.Scanner, prompt string) ([]Scrobble, error) {
+	scrobbles, err := sink.GetScrobbles(cmd.Int("limit"), cmd.Timestamp("from"), cmd.Timestamp("to"))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching scrobbles: %s", err.Error())
+	}
+	if len(scrobbles) == 0 {
+		return nil, errors.New("no scrobbles found (use --from, --to, and --limit to select other scrobbles)")
+	}
+
+	tbl := table.New("#", "ARTISTS", "TRACK", "ALBUM", "DURATION", "TIMESTAMP")
+	for i, s := range scrobbles {
+		tbl.AddRow(i+1, s.JoinArtists(), s.Track, s.Album, s.PrettyDuration(), s.Timestamp.Format(time.RFC1123))
+	}
+	tbl.Print()
+
+	fmt.Print(prompt)
+	input.Scan()
+
+	indexes, err := ParseSelection(input.Text(), len(scrobbles))
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Scrobble
+	for _, i := range indexes {
+		selected = append(selected, scrobbles[i])
+	}
+	return selected, nil
+}
+
+func ActionScrobble(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	var scrobbles []Scrobble
+	if filename := cmd.String("album-file"); filename != "" {
+		if len(cmd.StringSlice("artist")) > 0 || cmd.String("track") != "" || cmd.String("duration") != "" {
+			return errors.New("--artist, --track, and --duration cannot be used with --album-file")
+		}
+
+		album, err := ReadAlbumFile(filename)
+		if err != nil {
+			return fmt.Errorf("cannot read album file: %s", err.Error())
+		}
+		if scrobbles, err = album.Scrobbles(); err != nil {
+			return fmt.Errorf("invalid album file: %s", err.Error())
+		}
+	} else {
+		duration, err := ParseTrackDuration(cmd.String("duration"))
+		if err != nil {
+			return err
+		}
+		scrobbles = []Scrobble{{
+			Artists:   cmd.StringSlice("artist"),
+			Track:     cmd.String("track"),
+			Album:     cmd.String("album"),
+			Duration:  duration,
+			Timestamp: time.Time{},
+			MBIDs:     MBIDs{},
+		}}
+	}
+
+	SetManualTimestamps(scrobbles, cmd.Timestamp("at"), time.Now())
+
+	regexes := config.ParseRegexes()
+	for i := range scrobbles {
+		scrobbles[i].RegexReplace(regexes)
+		if scrobbles[i].JoinArtists() == "" || scrobbles[i].Track == "" {
+			return fmt.Errorf("scrobble %d has no artist or track", i+1)
+		}
+	}
+
+	if cmd.Bool("dry-run") {
+		tbl := table.New("ARTISTS", "TRACK", "ALBUM", "DURATION", "TIMESTAMP")
+		for _, s := range scrobbles {
+			tbl.AddRow(s.JoinArtists(), s.Track, s.Album, s.PrettyDuration(), s.Timestamp.Format(time.RFC1123))
+		}
+		tbl.Print()
+		return nil
+	}
+
+	sinks, err := config.SelectSinks(cmd.String("sink"))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+
+	tbl := table.New("SINK", "ARTISTS", "TRACK", "TIMESTAMP", "STATUS")
+	for _, sink := range sinks {
+		for i, err := range SendScrobbles(sink, scrobbles) {
+			status := "OK"
+			if err != nil {
+				failed++
+				status = err.Error()
+			}
+			s := scrobbles[i]
+			tbl.AddRow(sink.Name(), s.JoinArtists(), s.Track, s.Timestamp.Format(time.RFC1123), status)
+		}
+	}
+	tbl.Print()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scrobbles failed", failed, len(sinks)*len(scrobbles))
+	}
+	return nil
+}
+
+func ActionSync(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	since := cmd.Timestamp("since")
+	until := cmd.Timestamp("until")
+	fromName := cmd.StringArg("from")
+	toName := cmd.StringArg("to")
+
+	if fromName == "" || toName == "" {
+		return errors.New("usage: goscrobble sync <from> <to> (run `goscrobble list-sinks` to list all configured sinks)")
+	}
+
+	from, err := config.SelectSink(fromName)
+	if err != nil {
+		return err
+	}
+	to, err := config.SelectSink(toName)
+	if err != nil {
+		return err
+	}
+
+	fromScrobbles, err := from.GetScrobbles(0, since, until)
+	if err != nil {
+		return fmt.Errorf("error fetching scrobbles from %s: %s", fromName, err.Error())
+	}
+	toScrobbles, err := to.GetScrobbles(0, since, until)
+	if err != nil {
+		return fmt.Errorf("error fetching scrobbles from %s: %s", toName, err.Error())
+	}
+
+	diff := CompareScrobbles(
+		FilterScrobbles(fromScrobbles, since, until),
+		FilterScrobbles(toScrobbles, since, until),
+		cmd.Duration("tolerance"),
+	)
+
+	if len(diff.Missing) > 0 || len(diff.Extra) > 0 {
+		tbl := table.New("DIFF", "ARTISTS", "TRACK", "ALBUM", "TIMESTAMP")
+		for _, s := range diff.Missing {
+			tbl.AddRow("+", s.JoinArtists(), s.Track, s.Album, s.Timestamp.Format(time.RFC1123))
+		}
+		for _, s := range diff.Extra {
+			tbl.AddRow("-", s.JoinArtists(), s.Track, s.Album, s.Timestamp.Format(time.RFC1123))
+		}
+		tbl.Print()
+		fmt.Println()
+	}
+
+	fmt.Printf(
+		"%d matched, %d missing in %s (+), %d only in %s (-)\n",
+		diff.Matched, len(diff.Missing), toName, len(diff.Extra), toName,
+	)
+
+	if len(diff.Missing) == 0 {
+		return nil
+	}
+	if !cmd.Bool("apply") {
+		fmt.Println("Run with --apply to send the missing scrobbles to", toName)
+		return nil
+	}
+
+	failed := 0
+
+	tbl := table.New("ARTISTS", "TRACK", "TIMESTAMP", "STATUS")
+	for i, err := range SendScrobbles(to, diff.Missing) {
+		status := "OK"
+		if err != nil {
+			failed++
+			status = err.Error()
+		}
+		s := diff.Missing[i]
+		tbl.AddRow(s.JoinArtists(), s.Track, s.Timestamp.Format(time.RFC1123), status)
+	}
+	fmt.Println()
+	tbl.Print()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d scrobbles failed", failed, len(diff.Missing))
+	}
+	return nil
+}
+
+func ActionExport(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	sink, err := config.SelectSink(cmd.StringArg("sink"))
+	if err != nil {
+		return err
+	}
+
+	filename := cmd.String("output")
+	format := cmd.String("format")
+	if format == "" {
+		format = DetectFormat(filename)
+	}
+
+	output := os.Stdout
+	if filename != "" && filename != "-" {
+		//nolint:gosec
+		if output, err = os.Create(filename); err != nil {
+			return fmt.Errorf("cannot create output file: %s", err.Error())
+		}
+		defer CloseLogged(output)
+	}
+
+	buffered := bufio.NewWriter(output)
+	writer, err := NewScrobbleWriter(format, buffered)
+	if err != nil {
+		return err
+	}
+
+	count, err := ExportScrobbles(sink, writer, cmd.Timestamp("since"), cmd.Timestamp("until"), ExportPageSize)
+	if err != nil {
+		return fmt.Errorf("error exporting scrobbles: %s", err.Error())
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Exported scrobbles:", count)
+	return nil
+}
+
+func ActionImport(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	filename := cmd.StringArg("file")
+	if filename == "" {
+		return errors.New("no file provided (use `-` to read from the standard input)")
+	}
+
+	format := cmd.String("format")
+	if format == "" {
+		format = DetectFormat(filename)
+	}
+
+	input := os.Stdin
+	if filename != "-" {
+		var err error
+		//nolint:gosec
+		if input, err = os.Open(filename); err != nil {
+			return fmt.Errorf("cannot open file: %s", err.Error())
+		}
+		defer CloseLogged(input)
+	}
+
+	reader, err := NewScrobbleReader(format, input)
+	if err != nil {
+		return err
+	}
+	regexes := config.ParseRegexes()
+
+	if cmd.Bool("dry-run") {
+		tbl := table.New("ARTISTS", "TRACK", "ALBUM", "DURATION", "TIMESTAMP")
+		_, err := ReadScrobbleBatches(reader, regexes, ImportBatchSize, func(batch []Scrobble) error {
+			for _, s := range batch {
+				tbl.AddRow(s.JoinArtists(), s.Track, s.Album, s.PrettyDuration(), s.Timestamp.Format(time.RFC1123))
+			}
+			return nil
+		})
+		tbl.Print()
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %s", filename, err.Error())
+		}
+		return nil
+	}
+
+	sinks, err := config.SelectSinks(cmd.String("sink"))
+	if err != nil {
+		return err
+	}
+
+	imported := make([]int, len(sinks))
+	failed := make([]int, len(sinks))
+
+	skipped, err := ReadScrobbleBatches(reader, regexes, ImportBatchSize, func(batch []Scrobble) error {
+		for i, sink := range sinks {
+			for j, err := range SendScrobbles(sink, batch) {
+				if err == nil {
+					imported[i]++
+					continue
+				}
+				failed[i]++
+				log.Warn().
+					Str("sink", sink.Name()).
+					Interface("scrobble", batch[j]).
+					Err(err).
+					Msg("error importing scrobble")
+			}
+		}
+		return nil
+	})
+
+	tbl := table.New("SINK", "IMPORTED", "FAILED", "SKIPPED")
+	for i, sink := range sinks {
+		tbl.AddRow(sink.Name(), imported[i], failed[i], skipped)
+	}
+	tbl.Print()
+
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %s", filename, err.Error())
+	}
+
+	totalFailed := 0
+	for _, count := range failed {
+		totalFailed += count
+	}
+	if totalFailed > 0 {
+		return fmt.Errorf("%d scrobbles failed", totalFailed)
+	}
+	return nil
+}
+
+func ActionEvents(ctx context.Context, cmd *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	if config.EventLog == "" {
+		return errors.New("event log is disabled (set `event_log` in the config file)")
+	}
+
+	filter := EventFilter{
+		Types:  []EventType{},
+		Player: cmd.String("player"),
+		Since:  cmd.Timestamp("since"),
+	}
+	for _, eventType := range cmd.StringSlice("type") {
+		if !slices.Contains(EventTypes, EventType(eventType)) {
+			return fmt.Errorf("invalid event type: %s", eventType)
+		}
+		filter.Types = append(filter.Types, EventType(eventType))
+	}
+
+	raw := cmd.Bool("raw")
+	printEvent := func(event Event, line []byte) {
+		if raw {
+			fmt.Print(string(line))
+		} else {
+			fmt.Println(event.String())
+		}
+	}
+
+	//nolint:gosec
+	file, err := os.Open(config.EventLog)
+	if err != nil {
+		return fmt.Errorf("cannot open event log: %s", err.Error())
+	}
+	defer CloseLogged(file)
+
+	type eventLine struct {
+		event Event
+		line  []byte
+	}
+
+	var events []eventLine
+	offset, err := ReadEvents(file, filter, func(event Event, line []byte) {
+		events = append(events, eventLine{event: event, line: line})
+	})
+	if err != nil {
+		return fmt.Errorf("cannot read event log: %s", err.Error())
+	}
+
+	if limit := cmd.Int("limit"); limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+	for _, e := range events {
+		printEvent(e.event, e.line)
+	}
+
+	if !cmd.Bool("follow") {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	return FollowEvents(ctx, config.EventLog, offset, filter, printEvent)
+}
+
+func ActionCheckConfig(ctx context.Context, cmd *cli.Command) error {
 	_ = ctx.Value(ContextConfigKey).(Config)
 
-	fmt.Println("Configuration is valid")
+	if !cmd.Bool("print") {
+		fmt.Println("Configuration is valid")
+		return nil
+	}
+
+	// print secret references instead of the secrets
+	config, err := EffectiveConfig(ConfigFilename(cmd), ConfigOptions{Strict: true, Profile: cmd.String("profile")})
+	if err != nil {
+		return err
+	}
+
+	encoder := toml.NewEncoder(os.Stdout)
+	encoder.Indent = ""
+
+	return encoder.Encode(config)
+}
+
+func ActionDoctor(ctx context.Context, _ *cli.Command) error {
+	config := ctx.Value(ContextConfigKey).(Config)
+
+	results := RunDoctor(config)
+	if len(results) == 0 {
+		return errors.New("no sources or sinks configured")
+	}
+
+	failed := 0
+
+	tbl := table.New("TYPE", "KEY", "STATUS", "DETAILS", "HINT")
+	for _, r := range results {
+		details := r.Details
+		if r.Error != nil {
+			failed++
+			details = r.Error.Error()
+		}
+		tbl.AddRow(r.Kind, r.Key, r.Status(), details, r.Hint())
+	}
+	tbl.Print()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
 	return nil
 }
 
@@ -202,6 +1029,12 @@ func ActionLastFmAuth(ctx context.Context, cmd *cli.Command) error {
 
 	config := ctx.Value(ContextConfigKey).(Config)
 
+	if len(config.Sinks.LastFm) == 1 && key == "" {
+		for onlyKey := range config.Sinks.LastFm {
+			key = onlyKey
+		}
+	}
+
 	if len(config.Sinks.LastFm) == 0 {
 		return errors.New("no last.fm sink is configured")
 	} else if len(config.Sinks.LastFm) > 1 && key == "" {
@@ -226,8 +1059,6 @@ func ActionLastFmAuth(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("cannot get authorization token: %s", err.Error())
 	}
 
-	fmt.Println("Warning: authenticating last.fm will rewrite your config file and remove all comments!")
-
 	authURL := client.DesktopAuthorizationURL(token.Token)
 	if err := OpenURL(authURL); err != nil {
 		fmt.Println("Error opening URL in default browser:", err.Error())
@@ -251,16 +1082,43 @@ func ActionLastFmAuth(ctx context.Context, cmd *cli.Command) error {
 
 	fmt.Println("Logged in with user:", session.Session.Name)
 
-	lastFmConfig.SessionKey = session.Session.Key
-	lastFmConfig.Username = session.Session.Name
-	config.Sinks.LastFm[key] = lastFmConfig
+	filename := CredentialsFilename(ConfigFilename(cmd))
 
-	filename := ConfigFilename(cmd)
+	credentials, err := ReadCredentials(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read credentials file: %s", err.Error())
+	}
 
-	if err := config.Write(filename); err != nil {
-		return fmt.Errorf("cannnot write updated config file: %s", err.Error())
+	sessionKey := session.Session.Key
+	if cmd.Bool("keyring") {
+		name := "lastfm." + key + ".session_key"
+
+		keyring, err := OpenKeyring()
+		if err != nil {
+			return err
+		}
+		defer CloseLogged(keyring.Conn)
+
+		label := fmt.Sprintf("goscrobble last.fm session key (%s)", key)
+		if err := keyring.Set(label, KeyringAttributes(name), sessionKey); err != nil {
+			return fmt.Errorf("cannot save session key to keyring: %s", err.Error())
+		}
+
+		fmt.Println("Saved session key to keyring")
+		sessionKey = SecretKeyringPrefix + name
 	}
 
+	credentials.LastFm[key] = LastFmCredentials{
+		SessionKey: sessionKey,
+		Username:   session.Session.Name,
+	}
+
+	if err := credentials.Write(filename); err != nil {
+		return fmt.Errorf("cannot write credentials file: %s", err.Error())
+	}
+
+	fmt.Println("Saved credentials to", filename)
+
 	return nil
 }
 
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rs/zerolog/log"
+)
+
+// AlbumFile is a tracklist scrobbled by `goscrobble scrobble --album-file`. It is read as JSON if the file extension
+// is `.json`, as TOML otherwise.
+type AlbumFile struct {
+	Artists []string         `toml:"artists" json:"artists"`
+	Album   string           `toml:"album" json:"album"`
+	Tracks  []AlbumFileTrack `toml:"tracks" json:"tracks"`
+}
+
+type AlbumFileTrack struct {
+	// Artists replaces the artists of the album (e.g., for compilations), if set.
+	Artists []string `toml:"artists" json:"artists"`
+	Track   string   `toml:"track" json:"track"`
+	// Duration is parsed using [ParseTrackDuration].
+	Duration string `toml:"duration" json:"duration"`
+}
+
+func ReadAlbumFile(filename string) (AlbumFile, error) {
+	var album AlbumFile
+
+	//nolint:gosec
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return album, err
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		err = json.Unmarshal(data, &album)
+	} else {
+		_, err = toml.Decode(string(data), &album)
+	}
+	if err != nil {
+		return album, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	if len(album.Tracks) == 0 {
+		return album, fmt.Errorf("%s: no tracks found", filename)
+	}
+	return album, nil
+}
+
+// Scrobbles returns one scrobble per track, without timestamps (see [SetManualTimestamps]). All tracks must have a
+// duration, since it is used to calculate the timestamps.
+func (a AlbumFile) Scrobbles() ([]Scrobble, error) {
+	var scrobbles []Scrobble
+
+	for i, track := range a.Tracks {
+		artists := a.Artists
+		if len(track.Artists) > 0 {
+			artists = track.Artists
+		}
+
+		duration, err := ParseTrackDuration(track.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", i+1, err)
+		}
+		if duration == 0 {
+			return nil, fmt.Errorf("track %d: no duration", i+1)
+		}
+
+		scrobbles = append(scrobbles, Scrobble{
+			Artists:   artists,
+			Track:     track.Track,
+			Album:     a.Album,
+			Duration:  duration,
+			Timestamp: time.Time{},
+			MBIDs:     MBIDs{},
+		})
+	}
+
+	return scrobbles, nil
+}
+
+// ParseTrackDuration parses durations like `3:45`, `1:02:03`, `245` (seconds), or `3m45s`. An empty value is
+// parsed as 0.
+func ParseTrackDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case value == "":
+		return 0, nil
+	case strings.Contains(value, ":"):
+		parts := strings.Split(value, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+
+		var duration time.Duration
+		for _, part := range parts {
+			number, err := strconv.Atoi(part)
+			if err != nil || number < 0 {
+				return 0, fmt.Errorf("invalid duration: %s", value)
+			}
+			duration = duration*60 + time.Duration(number)
+		}
+		return duration * time.Second, nil
+	default:
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, nil
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		return duration, nil
+	}
+}
+
+// SetManualTimestamps sets back-to-back timestamps: the first scrobble starts at start, each following scrobble
+// starts when the previous one ended. If start is zero, the last scrobble ends at now.
+func SetManualTimestamps(scrobbles []Scrobble, start, now time.Time) {
+	if start.IsZero() {
+		start = now
+		for _, scrobble := range scrobbles {
+			start = start.Add(-scrobble.Duration)
+		}
+	}
+
+	for i := range scrobbles {
+		scrobbles[i].Timestamp = start
+		start = start.Add(scrobbles[i].Duration)
+	}
+}
+
+// SelectSinks returns all sinks if name is empty, otherwise the sinks with a matching key (e.g., `csv.default`) or
+// name (e.g., `csv`). Sinks that cannot be set up are skipped.
+func (c Config) SelectSinks(name string) ([]Sink, error) {
+	var sinks []Sink
+	var errs []error
+
+	for _, setup := range c.SinkSetups() {
+		if name != "" && setup.Key != name && (setup.Sink == nil || setup.Sink.Name() != name) {
+			continue
+		}
+		if setup.Error != nil {
+			log.Error().
+				Err(setup.Error).
+				Str("key", setup.Key).
+				Msg("error setting up sink")
+			errs = append(errs, fmt.Errorf("cannot set up sink %s: %w", setup.Key, setup.Error))
+			continue
+		}
+		sinks = append(sinks, setup.Sink)
+	}
+
+	if len(sinks) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	} else if len(sinks) == 0 {
+		return nil, errors.New("no matching sink found (run `goscrobble list-sinks` to list all configured sinks)")
+	}
+	return sinks, nil
+}
+
+// SelectSink returns the sink with a matching key or name (see [Config.SelectSinks]), which must be unique.
+func (c Config) SelectSink(name string) (Sink, error) {
+	if name == "" {
+		return nil, errors.New("no sink provided (run `goscrobble list-sinks` to list all configured sinks)")
+	}
+
+	sinks, err := c.SelectSinks(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(sinks) > 1 {
+		return nil, fmt.Errorf("%d sinks match %s, use the sink key instead (e.g., `csv.default`)", len(sinks), name)
+	}
+	return sinks[0], nil
+}
+
+// SendScrobbles sends scrobbles to a sink, using a single request if the sink supports it. It returns one error (or
+// nil) per scrobble.
+func SendScrobbles(sink Sink, scrobbles []Scrobble) []error {
+	errs := make([]error, len(scrobbles))
+
+	if batchSink, ok := sink.(BatchSink); ok {
+		results, err := batchSink.ScrobbleBatch(scrobbles)
+		for i := range scrobbles {
+			switch {
+			case i < len(results):
+				errs[i] = results[i].Error
+			case err != nil:
+				errs[i] = err
+			default:
+				errs[i] = errors.New("no result returned by sink")
+			}
+		}
+		return errs
+	}
+
+	for i, scrobble := range scrobbles {
+		errs[i] = sink.Scrobble(scrobble)
+	}
+	return errs
+}
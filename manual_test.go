@@ -0,0 +1,130 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrackDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"":        0,
+		"3:45":    3*time.Minute + 45*time.Second,
+		"1:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+		"245":     245 * time.Second,
+		"3m45s":   3*time.Minute + 45*time.Second,
+	} {
+		duration, err := main.ParseTrackDuration(value)
+		require.NoError(t, err)
+		require.Equal(t, expected, duration, value)
+	}
+
+	for _, value := range []string{"3:4x", "1:2:3:4", "-5", "-3m", "soon"} {
+		_, err := main.ParseTrackDuration(value)
+		require.Error(t, err, value)
+	}
+}
+
+func TestReadAlbumFile(t *testing.T) {
+	directory := t.TempDir()
+
+	tomlFilename := filepath.Join(directory, "album.toml")
+	require.NoError(t, os.WriteFile(tomlFilename, []byte(`
+artists = ["Placebo"]
+album = "Without You I'm Nothing"
+
+[[tracks]]
+track = "Pure Morning"
+duration = "4:14"
+
+[[tracks]]
+artists = ["Placebo", "David Bowie"]
+track = "Without You I'm Nothing"
+duration = "251"
+`), 0600))
+
+	jsonFilename := filepath.Join(directory, "album.json")
+	require.NoError(t, os.WriteFile(jsonFilename, []byte(`{
+  "artists": ["Placebo"],
+  "album": "Without You I'm Nothing",
+  "tracks": [
+    {"track": "Pure Morning", "duration": "4:14"},
+    {"artists": ["Placebo", "David Bowie"], "track": "Without You I'm Nothing", "duration": "251"}
+  ]
+}`), 0600))
+
+	for _, filename := range []string{tomlFilename, jsonFilename} {
+		album, err := main.ReadAlbumFile(filename)
+		require.NoError(t, err)
+
+		scrobbles, err := album.Scrobbles()
+		require.NoError(t, err)
+		require.Len(t, scrobbles, 2)
+		require.Equal(t, []string{"Placebo"}, scrobbles[0].Artists)
+		require.Equal(t, defaultScrobble.Artists, scrobbles[1].Artists)
+		require.Equal(t, "Without You I'm Nothing", scrobbles[1].Album)
+		require.Equal(t, defaultScrobble.Duration, scrobbles[1].Duration)
+	}
+
+	emptyFilename := filepath.Join(directory, "empty.toml")
+	require.NoError(t, os.WriteFile(emptyFilename, []byte(`album = "Nothing"`), 0600))
+	_, err := main.ReadAlbumFile(emptyFilename)
+	require.ErrorContains(t, err, "no tracks found")
+
+	album := main.AlbumFile{
+		Artists: []string{"Placebo"},
+		Album:   "Without You I'm Nothing",
+		Tracks:  []main.AlbumFileTrack{{Artists: nil, Track: "Pure Morning", Duration: ""}},
+	}
+	_, err = album.Scrobbles()
+	require.ErrorContains(t, err, "track 1: no duration")
+}
+
+func TestSetManualTimestamps(t *testing.T) {
+	now := time.Now()
+	start := now.Add(-time.Hour)
+
+	scrobbles := []main.Scrobble{defaultScrobble, defaultScrobble}
+	main.SetManualTimestamps(scrobbles, start, now)
+	require.Equal(t, start, scrobbles[0].Timestamp)
+	require.Equal(t, start.Add(defaultScrobble.Duration), scrobbles[1].Timestamp)
+
+	main.SetManualTimestamps(scrobbles, time.Time{}, now)
+	require.Equal(t, now.Add(-2*defaultScrobble.Duration), scrobbles[0].Timestamp)
+	require.Equal(t, now.Add(-defaultScrobble.Duration), scrobbles[1].Timestamp)
+}
+
+func TestSelectSinks(t *testing.T) {
+	config := main.DefaultConfig
+
+	// the default last.fm sink is not authenticated
+	sinks, err := config.SelectSinks("")
+	require.NoError(t, err)
+	require.Len(t, sinks, 1)
+
+	_, err = config.SelectSinks("lastfm.default")
+	require.ErrorContains(t, err, "cannot set up sink lastfm.default")
+
+	sinks, err = config.SelectSinks("csv.default")
+	require.NoError(t, err)
+	require.Len(t, sinks, 1)
+	require.Equal(t, "csv", sinks[0].Name())
+
+	_, err = config.SelectSinks("csv.other")
+	require.ErrorContains(t, err, "no matching sink found")
+}
+
+func TestSendScrobbles(t *testing.T) {
+	fakeSink := &FakeSink{}
+	errs := main.SendScrobbles(fakeSink, []main.Scrobble{defaultScrobble, defaultScrobble})
+	require.Equal(t, []error{nil, nil}, errs)
+	require.Len(t, fakeSink.ScrobbleLog, 2)
+
+	fakeSink.Error = true
+	errs = main.SendScrobbles(fakeSink, []main.Scrobble{defaultScrobble})
+	require.Error(t, errs[0])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// MissingMetadataPolicy allows scrobbling tracks of matching players without album or duration. Tracks without
+// duration are scrobbled after DurationThreshold, they are skipped if it is 0.
+type MissingMetadataPolicy struct {
+	Player            *regexp.Regexp
+	AllowEmptyAlbum   bool
+	DurationThreshold time.Duration
+}
+
+func (c Config) ParseMissingMetadataPolicies() []MissingMetadataPolicy {
+	var policies []MissingMetadataPolicy
+
+	for _, p := range c.MissingMetadata {
+		player, err := regexp.Compile(p.Player)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("expression", p.Player).
+				Msg("error compiling missing metadata player expression")
+			continue
+		}
+		policies = append(policies, MissingMetadataPolicy{
+			Player:            player,
+			AllowEmptyAlbum:   p.AllowEmptyAlbum,
+			DurationThreshold: time.Duration(max(p.DurationThreshold, 0)) * time.Second,
+		})
+	}
+
+	return policies
+}
+
+// MissingMetadataPolicy returns the first policy matching the player. Players without a matching policy require
+// all fields, stream players (see [Stream]) never have album or duration.
+func (l *MainLoop) MissingMetadataPolicy(player string) MissingMetadataPolicy {
+	if stream, ok := l.Stream(player); ok {
+		return MissingMetadataPolicy{Player: stream.Player, AllowEmptyAlbum: true, DurationThreshold: stream.ListenThreshold}
+	}
+
+	for _, policy := range l.MissingMetadata {
+		if policy.Player.MatchString(player) {
+			return policy
+		}
+	}
+	return MissingMetadataPolicy{Player: nil, AllowEmptyAlbum: false, DurationThreshold: 0}
+}
+
+// CheckMetadata checks if a track can be scrobbled using the missing metadata policy of the player and returns the
+// missing fields otherwise.
+func (l *MainLoop) CheckMetadata(player string, scrobble Scrobble) (string, bool) {
+	policy := l.MissingMetadataPolicy(player)
+
+	switch {
+	case scrobble.JoinArtists() == "" || scrobble.Track == "":
+		return "missing artist or track", false
+	case scrobble.Album == "" && !policy.AllowEmptyAlbum:
+		return "missing album", false
+	case scrobble.Duration == 0 && policy.DurationThreshold == 0:
+		return "missing duration", false
+	default:
+		return "", true
+	}
+}
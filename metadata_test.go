@@ -0,0 +1,78 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	config := main.DefaultConfig
+	config.MissingMetadata = []main.MissingMetadataConfig{
+		{Player: "[", AllowEmptyAlbum: true, DurationThreshold: 30},
+		{Player: "^dbus:.*firefox", AllowEmptyAlbum: true, DurationThreshold: 0},
+		{Player: "^dbus:", AllowEmptyAlbum: false, DurationThreshold: 60},
+	}
+	loop := main.NewMainLoop(config, []main.Source{}, []main.Sink{}, nil)
+	require.Len(t, loop.MissingMetadata, 2)
+
+	check := func(player string, update func(scrobble *main.Scrobble)) string {
+		scrobble := defaultScrobble
+		update(&scrobble)
+		reason, ok := loop.CheckMetadata(player, scrobble)
+		require.Equal(t, reason == "", ok)
+		return reason
+	}
+
+	noAlbum := func(scrobble *main.Scrobble) { scrobble.Album = "" }
+	noDuration := func(scrobble *main.Scrobble) { scrobble.Duration = 0 }
+
+	require.Empty(t, check("webhook:kitchen", func(_ *main.Scrobble) {}))
+	require.Equal(t, "missing album", check("webhook:kitchen", noAlbum))
+	require.Equal(t, "missing duration", check("webhook:kitchen", noDuration))
+	require.Equal(t, "missing artist or track", check("webhook:kitchen", func(scrobble *main.Scrobble) {
+		scrobble.Track = ""
+	}))
+
+	require.Empty(t, check("dbus:org.mpris.MediaPlayer2.firefox.instance_1_42", noAlbum))
+	require.Equal(t, "missing duration", check("dbus:org.mpris.MediaPlayer2.firefox.instance_1_42", noDuration))
+	require.Equal(t, "missing album", check("dbus:org.mpris.MediaPlayer2.vlc", noAlbum))
+	require.Empty(t, check("dbus:org.mpris.MediaPlayer2.vlc", noDuration))
+}
+
+func TestMainLoopMissingMetadata(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource.PlaybackStatus.Album = ""
+	fakeSource.PlaybackStatus.Duration = 0
+	fakeSource.PlaybackStatus.Position = 0
+	fakeSink := &FakeSink{}
+
+	loop := main.NewMainLoop(main.DefaultConfig, []main.Source{fakeSource}, []main.Sink{fakeSink}, nil)
+	loop.RunOnce()
+	require.Empty(t, fakeSink.NowPlayingLog)
+	require.Contains(t, loop.Skipped, "fake player")
+
+	config := main.DefaultConfig
+	config.MissingMetadata = []main.MissingMetadataConfig{
+		{Player: "^fake player$", AllowEmptyAlbum: true, DurationThreshold: 60},
+	}
+	loop = main.NewMainLoop(config, []main.Source{fakeSource}, []main.Sink{fakeSink}, nil)
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Empty(t, loop.Skipped)
+
+	loop.RunOnce()
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	fakeSource.PlaybackStatus.Position = 61 * time.Second
+	loop.RunOnce()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+	require.Empty(t, fakeSink.ScrobbleLog[0].Album)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Metrics stores counters exported in the Prometheus text format. Sinks and sources are identified by their
+// name, so values of sinks with the same name (e.g., multiple CSV files) are added up. All methods are no-ops if
+// the metrics are nil.
+//
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+type Metrics struct {
+	mutex sync.Mutex
+
+	scrobblesSent     map[string]float64
+	scrobblesFailed   map[string]float64
+	nowPlayingSent    map[string]float64
+	nowPlayingFailed  map[string]float64
+	lastScrobble      map[string]float64
+	queueDepth        map[string]float64
+	sourceErrors      map[string]float64
+	sourcePollSeconds map[string]float64
+	sourcePolls       map[string]float64
+	activePlayers     float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		mutex:             sync.Mutex{},
+		scrobblesSent:     map[string]float64{},
+		scrobblesFailed:   map[string]float64{},
+		nowPlayingSent:    map[string]float64{},
+		nowPlayingFailed:  map[string]float64{},
+		lastScrobble:      map[string]float64{},
+		queueDepth:        map[string]float64{},
+		sourceErrors:      map[string]float64{},
+		sourcePollSeconds: map[string]float64{},
+		sourcePolls:       map[string]float64{},
+		activePlayers:     0,
+	}
+}
+
+func (m *Metrics) ObserveScrobble(sink string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err != nil {
+		m.scrobblesFailed[sink]++
+		return
+	}
+	m.scrobblesSent[sink]++
+	m.lastScrobble[sink] = float64(time.Now().Unix())
+}
+
+func (m *Metrics) ObserveNowPlaying(sink string, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err != nil {
+		m.nowPlayingFailed[sink]++
+	} else {
+		m.nowPlayingSent[sink]++
+	}
+}
+
+func (m *Metrics) ObserveSourcePoll(source string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.sourcePolls[source]++
+	m.sourcePollSeconds[source] += duration.Seconds()
+	if err != nil {
+		m.sourceErrors[source]++
+	} else if _, ok := m.sourceErrors[source]; !ok {
+		m.sourceErrors[source] = 0
+	}
+}
+
+func (m *Metrics) SetActivePlayers(players int) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.activePlayers = float64(players)
+}
+
+// SetQueueDepth replaces the number of pending scrobbles per sink.
+func (m *Metrics) SetQueueDepth(depth map[string]int) {
+	if m == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	clear(m.queueDepth)
+	for sink, pending := range depth {
+		m.queueDepth[sink] = float64(pending)
+	}
+}
+
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var builder strings.Builder
+
+	writeMetric(&builder, "goscrobble_scrobbles_sent_total", "counter",
+		"Scrobbles saved by a sink.", "sink", m.scrobblesSent)
+	writeMetric(&builder, "goscrobble_scrobbles_failed_total", "counter",
+		"Scrobbles that could not be saved or were ignored by a sink.", "sink", m.scrobblesFailed)
+	writeMetric(&builder, "goscrobble_now_playing_sent_total", "counter",
+		"Now playing updates sent to a sink.", "sink", m.nowPlayingSent)
+	writeMetric(&builder, "goscrobble_now_playing_failed_total", "counter",
+		"Now playing updates that could not be sent to a sink.", "sink", m.nowPlayingFailed)
+	writeMetric(&builder, "goscrobble_last_scrobble_timestamp_seconds", "gauge",
+		"Unix time of the last scrobble saved by a sink.", "sink", m.lastScrobble)
+	writeMetric(&builder, "goscrobble_retry_queue_scrobbles", "gauge",
+		"Scrobbles waiting to be sent again.", "sink", m.queueDepth)
+	writeMetric(&builder, "goscrobble_source_errors_total", "counter",
+		"Errors while getting the playback status from a source.", "source", m.sourceErrors)
+
+	builder.WriteString("# HELP goscrobble_source_poll_duration_seconds Time spent getting the playback status.\n")
+	builder.WriteString("# TYPE goscrobble_source_poll_duration_seconds summary\n")
+	for _, source := range slices.Sorted(maps.Keys(m.sourcePolls)) {
+		fmt.Fprintf(&builder, "goscrobble_source_poll_duration_seconds_sum{source=\"%s\"} %g\n",
+			EscapeLabelValue(source), m.sourcePollSeconds[source])
+		fmt.Fprintf(&builder, "goscrobble_source_poll_duration_seconds_count{source=\"%s\"} %g\n",
+			EscapeLabelValue(source), m.sourcePolls[source])
+	}
+
+	builder.WriteString("# HELP goscrobble_active_players Players reported by all sources.\n")
+	builder.WriteString("# TYPE goscrobble_active_players gauge\n")
+	fmt.Fprintf(&builder, "goscrobble_active_players %g\n", m.activePlayers)
+
+	written, err := io.WriteString(w, builder.String())
+	return int64(written), err
+}
+
+func writeMetric(builder *strings.Builder, name, metricType, help, label string, values map[string]float64) {
+	fmt.Fprintf(builder, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(builder, "# TYPE %s %s\n", name, metricType)
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(builder, "%s{%s=\"%s\"} %g\n", name, label, EscapeLabelValue(key), values[key])
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func EscapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := m.WriteTo(w); err != nil {
+			log.Error().
+				Err(err).
+				Msg("error writing metrics")
+		}
+	})
+	return mux
+}
+
+// ServeMetrics starts an HTTP server exposing the metrics at /metrics.
+func ServeMetrics(address string, metrics *Metrics) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("address", listener.Addr().String()).
+		Msg("serving metrics")
+
+	//nolint:exhaustruct
+	server := &http.Server{Handler: metrics.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().
+				Err(err).
+				Str("address", address).
+				Msg("metrics server stopped")
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+
+	config := main.DefaultConfig
+	config.MetricsAddress = "127.0.0.1:0"
+
+	loop := main.NewMainLoop(config, []main.Source{fakeSource}, []main.Sink{fakeSink}, fakeNotifier.SendNotification)
+	require.NotNil(t, loop.Metrics)
+
+	loop.RunOnce()
+	fakeSource.PlaybackStatus.Position = time.Duration(time.Second * 200)
+	fakeSource.Error = true
+	loop.RunOnce()
+
+	server := httptest.NewServer(loop.Metrics.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer main.CloseLogged(response.Body)
+
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Contains(t, response.Header.Get("Content-Type"), "text/plain")
+
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	lines := strings.Split(string(body), "\n")
+	require.Contains(t, lines, `goscrobble_scrobbles_sent_total{sink="fake sink"} 1`)
+	require.Contains(t, lines, `goscrobble_now_playing_sent_total{sink="fake sink"} 1`)
+	require.Contains(t, lines, `goscrobble_retry_queue_scrobbles{sink="fake sink"} 0`)
+	require.Contains(t, lines, `goscrobble_source_errors_total{source="fake source"} 1`)
+	require.Contains(t, lines, `goscrobble_source_poll_duration_seconds_count{source="fake source"} 2`)
+	require.Contains(t, lines, `goscrobble_active_players 1`)
+	require.Contains(t, lines, "# TYPE goscrobble_scrobbles_sent_total counter")
+}
+
+func TestMetricsNil(t *testing.T) {
+	var metrics *main.Metrics
+	metrics.ObserveScrobble("fake sink", errors.New("fake error"))
+	metrics.ObserveNowPlaying("fake sink", nil)
+	metrics.ObserveSourcePoll("fake source", time.Second, nil)
+	metrics.SetActivePlayers(1)
+	metrics.SetQueueDepth(map[string]int{"fake sink": 1})
+
+	loop := main.NewMainLoop(main.DefaultConfig, []main.Source{}, []main.Sink{}, nil)
+	require.Nil(t, loop.Metrics)
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	require.Equal(t, `a\\b\"c\nd`, main.EscapeLabelValue("a\\b\"c\nd"))
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MusicBrainzBaseURL       = "https://musicbrainz.org/ws/2"
+	MusicBrainzCacheFileName = "musicbrainz.json"
+	// MusicBrainzUserAgent identifies goscrobble, as required by the MusicBrainz API.
+	//
+	// https://musicbrainz.org/doc/MusicBrainz_API/Rate_Limiting
+	MusicBrainzUserAgent = "goscrobble ( https://github.com/p-mng/goscrobble )"
+	// MusicBrainzRequestInterval is the minimum time between two requests (the API allows one request per second).
+	MusicBrainzRequestInterval = time.Second
+	// MusicBrainzNotFoundTTL is the time after which tracks that were not found are looked up again.
+	MusicBrainzNotFoundTTL = 7 * 24 * time.Hour
+	// MusicBrainzRetryInterval is the time after which failed lookups (e.g., while offline) are retried.
+	MusicBrainzRetryInterval = 5 * time.Minute
+	// MusicBrainzDefaultMinScore is used if min_score is not set.
+	MusicBrainzDefaultMinScore = 90
+	// MusicBrainzMaxPendingLookups is the number of tracks waiting for a lookup in the background.
+	MusicBrainzMaxPendingLookups = 100
+)
+
+// Fields filled by the MusicBrainz enrichment.
+const (
+	MusicBrainzFieldAlbum  = "album"
+	MusicBrainzFieldArtist = "artist"
+	MusicBrainzFieldMBID   = "mbid"
+)
+
+var MusicBrainzFields = []string{MusicBrainzFieldAlbum, MusicBrainzFieldArtist, MusicBrainzFieldMBID}
+
+// MusicBrainz fills in missing metadata using the MusicBrainz recording search. Results (including tracks that were
+// not found) are cached in a file, so tracks are only looked up once and enrichment works offline. All methods are
+// no-ops if m is nil.
+//
+// https://musicbrainz.org/doc/MusicBrainz_API/Search#Recording
+type MusicBrainz struct {
+	Client   http.Client
+	BaseURL  string
+	Fields   []string
+	MinScore int
+	Cache    *MusicBrainzCache
+	// RetryInterval is the time after which failed lookups are retried (MusicBrainzRetryInterval by default).
+	RetryInterval time.Duration
+
+	// mutex guards the cache, failed, and pending, since tracks are also looked up in the background.
+	mutex sync.Mutex
+	// failed stores the time of failed lookups, which are not cached in the file.
+	failed map[string]time.Time
+	// pending stores the tracks waiting for a lookup in the background.
+	pending  map[string]bool
+	requests chan Scrobble
+	worker   sync.Once
+
+	// requestMutex guards lastRequest, so concurrent lookups respect the rate limit.
+	requestMutex sync.Mutex
+	lastRequest  time.Time
+}
+
+// MusicBrainzRecording is the result of a lookup, Found is false if no recording matched.
+type MusicBrainzRecording struct {
+	Found   bool      `json:"found"`
+	Artists []string  `json:"artists,omitempty"`
+	Album   string    `json:"album,omitempty"`
+	MBIDs   MBIDs     `json:"mbids,omitzero"`
+	Time    time.Time `json:"time"`
+}
+
+type MusicBrainzCache struct {
+	Filename   string
+	Recordings map[string]MusicBrainzRecording
+}
+
+// https://musicbrainz.org/doc/MusicBrainz_API/Search#Recording
+type MusicBrainzSearchResponse struct {
+	Recordings []struct {
+		ID           string `json:"id"`
+		Score        int    `json:"score"`
+		Title        string `json:"title"`
+		ArtistCredit []struct {
+			Name   string `json:"name"`
+			Artist struct {
+				ID string `json:"id"`
+			} `json:"artist"`
+		} `json:"artist-credit"`
+		Releases []MusicBrainzRelease `json:"releases"`
+	} `json:"recordings"`
+}
+
+type MusicBrainzRelease struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Status       string `json:"status"`
+	ReleaseGroup struct {
+		PrimaryType string `json:"primary-type"`
+	} `json:"release-group"`
+}
+
+func MusicBrainzCacheFilename() string {
+	return filepath.Join(CacheDir(), MusicBrainzCacheFileName)
+}
+
+// NewMusicBrainz returns nil if enrichment is disabled.
+func NewMusicBrainz(c MusicBrainzConfig, cacheFilename string) *MusicBrainz {
+	if !c.Enabled {
+		return nil
+	}
+
+	cache, err := LoadMusicBrainzCache(cacheFilename)
+	if err != nil {
+		log.Error().
+			Str("filename", cacheFilename).
+			Err(err).
+			Msg("error loading MusicBrainz cache, starting with an empty cache")
+		cache = &MusicBrainzCache{Filename: cacheFilename, Recordings: map[string]MusicBrainzRecording{}}
+	}
+
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = MusicBrainzBaseURL
+	}
+	minScore := c.MinScore
+	if minScore == 0 {
+		minScore = MusicBrainzDefaultMinScore
+	}
+
+	return &MusicBrainz{
+		Client:        NewHTTPClient(),
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		Fields:        c.Fields,
+		MinScore:      minScore,
+		Cache:         cache,
+		RetryInterval: MusicBrainzRetryInterval,
+		mutex:         sync.Mutex{},
+		failed:        map[string]time.Time{},
+		pending:       map[string]bool{},
+		requests:      make(chan Scrobble, MusicBrainzMaxPendingLookups),
+		worker:        sync.Once{},
+		requestMutex:  sync.Mutex{},
+		lastRequest:   time.Time{},
+	}
+}
+
+// LoadMusicBrainzCache reads the cache file. A missing file is not an error.
+func LoadMusicBrainzCache(filename string) (*MusicBrainzCache, error) {
+	cache := &MusicBrainzCache{Filename: filename, Recordings: map[string]MusicBrainzRecording{}}
+
+	//nolint:gosec
+	data, err := os.ReadFile(filename)
+	switch {
+	case os.IsNotExist(err):
+		return cache, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &cache.Recordings); err != nil {
+		return nil, err
+	}
+	if cache.Recordings == nil {
+		cache.Recordings = map[string]MusicBrainzRecording{}
+	}
+
+	log.Debug().
+		Str("filename", filename).
+		Int("recordings", len(cache.Recordings)).
+		Msg("loaded MusicBrainz cache")
+
+	return cache, nil
+}
+
+func (c *MusicBrainzCache) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.Filename), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(c.Recordings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(c.Filename, data, 0600)
+}
+
+// MusicBrainzCacheKey identifies a track in the cache. The album is part of the key, since it is used to select
+// the release.
+func MusicBrainzCacheKey(scrobble Scrobble) string {
+	return strings.ToLower(strings.Join([]string{scrobble.JoinArtists(), scrobble.Track, scrobble.Album}, "\t"))
+}
+
+// Enrich fills in the fields enabled in the config: a missing album, the canonical artist credit, and MBIDs. Tracks
+// that are not cached are looked up, lookup errors are logged and the scrobble is left unchanged.
+func (m *MusicBrainz) Enrich(scrobble *Scrobble) {
+	if m == nil || scrobble.JoinArtists() == "" || scrobble.Track == "" {
+		return
+	}
+
+	key := MusicBrainzCacheKey(*scrobble)
+	recording, lookup := m.cached(key)
+	if lookup {
+		var ok bool
+		if recording, ok = m.update(key, *scrobble); !ok {
+			return
+		}
+	}
+
+	m.apply(scrobble, recording)
+}
+
+// EnrichCached is like Enrich, but only uses cached results, so it never blocks. Tracks that are not cached are
+// looked up in the background and enriched the next time.
+func (m *MusicBrainz) EnrichCached(scrobble *Scrobble) {
+	if m == nil || scrobble.JoinArtists() == "" || scrobble.Track == "" {
+		return
+	}
+
+	key := MusicBrainzCacheKey(*scrobble)
+	recording, lookup := m.cached(key)
+	if lookup {
+		m.requestLookup(key, *scrobble)
+		return
+	}
+
+	m.apply(scrobble, recording)
+}
+
+// cached returns the cached recording of a track, and true if the track needs to be looked up (it is not cached,
+// or was not found a while ago, and no lookup failed recently).
+func (m *MusicBrainz) cached(key string) (MusicBrainzRecording, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	recording, ok := m.Cache.Recordings[key]
+	if ok && (recording.Found || time.Since(recording.Time) <= MusicBrainzNotFoundTTL) {
+		return recording, false
+	}
+	if failed, ok := m.failed[key]; ok && time.Since(failed) < m.RetryInterval {
+		return recording, false
+	}
+	return recording, true
+}
+
+// update looks up a track and saves the result in the cache. It returns false if the lookup failed.
+func (m *MusicBrainz) update(key string, scrobble Scrobble) (MusicBrainzRecording, bool) {
+	recording, err := m.Lookup(scrobble)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err != nil {
+		log.Warn().
+			Interface("scrobble", scrobble).
+			Err(err).
+			Msg("error looking up track on MusicBrainz")
+		m.failed[key] = time.Now()
+		return recording, false
+	}
+	delete(m.failed, key)
+
+	m.Cache.Recordings[key] = recording
+	if err := m.Cache.Save(); err != nil {
+		log.Error().
+			Str("filename", m.Cache.Filename).
+			Err(err).
+			Msg("error saving MusicBrainz cache")
+	}
+
+	return recording, true
+}
+
+// requestLookup starts the background worker on first use and adds the track to its queue, unless it is already
+// queued or the queue is full (the track is requested again the next time it is enriched).
+func (m *MusicBrainz) requestLookup(key string, scrobble Scrobble) {
+	m.worker.Do(func() {
+		go m.lookupWorker()
+	})
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pending[key] {
+		return
+	}
+
+	select {
+	case m.requests <- scrobble:
+		m.pending[key] = true
+	default:
+		log.Debug().
+			Interface("scrobble", scrobble).
+			Msg("too many pending MusicBrainz lookups, skipping track")
+	}
+}
+
+func (m *MusicBrainz) lookupWorker() {
+	for scrobble := range m.requests {
+		key := MusicBrainzCacheKey(scrobble)
+		if _, lookup := m.cached(key); lookup {
+			m.update(key, scrobble)
+		}
+
+		m.mutex.Lock()
+		delete(m.pending, key)
+		m.mutex.Unlock()
+	}
+}
+
+func (m *MusicBrainz) apply(scrobble *Scrobble, recording MusicBrainzRecording) {
+	if !recording.Found {
+		return
+	}
+
+	if slices.Contains(m.Fields, MusicBrainzFieldAlbum) && scrobble.Album == "" {
+		scrobble.Album = recording.Album
+	}
+	if slices.Contains(m.Fields, MusicBrainzFieldArtist) && len(recording.Artists) > 0 {
+		scrobble.Artists = recording.Artists
+	}
+	if slices.Contains(m.Fields, MusicBrainzFieldMBID) {
+		scrobble.MBIDs = recording.MBIDs
+	}
+}
+
+// Lookup searches for a recording by artist, track, and duration (if known), and returns the first result with a
+// score of at least MinScore. The release matching the album is preferred, then official albums.
+func (m *MusicBrainz) Lookup(scrobble Scrobble) (MusicBrainzRecording, error) {
+	query := fmt.Sprintf(
+		`recording:"%s" AND artist:"%s"`,
+		luceneEscape(scrobble.Track),
+		luceneEscape(scrobble.JoinArtists()),
+	)
+	if scrobble.Duration > 0 {
+		milliseconds := scrobble.Duration.Milliseconds()
+		query += fmt.Sprintf(" AND dur:[%d TO %d]", milliseconds-10000, milliseconds+10000)
+	}
+
+	values := url.Values{}
+	values.Set("query", query)
+	values.Set("fmt", "json")
+	values.Set("limit", "5")
+
+	// respect the rate limit
+	m.requestMutex.Lock()
+	if wait := MusicBrainzRequestInterval - time.Since(m.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	m.lastRequest = time.Now()
+	m.requestMutex.Unlock()
+
+	log.Debug().
+		Str("query", query).
+		Msg("looking up track on MusicBrainz")
+
+	request, err := http.NewRequest(http.MethodGet, m.BaseURL+"/recording?"+values.Encode(), nil)
+	if err != nil {
+		return MusicBrainzRecording{}, err
+	}
+	request.Header.Set("User-Agent", MusicBrainzUserAgent)
+	request.Header.Set("Accept", "application/json")
+
+	response, err := m.Client.Do(request)
+	if err != nil {
+		return MusicBrainzRecording{}, err
+	}
+	defer CloseLogged(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return MusicBrainzRecording{}, fmt.Errorf("API returned unexpected status: %s", response.Status)
+	}
+
+	var body MusicBrainzSearchResponse
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return MusicBrainzRecording{}, err
+	}
+
+	for _, result := range body.Recordings {
+		if result.Score < m.MinScore {
+			continue
+		}
+
+		recording := MusicBrainzRecording{
+			Found:   true,
+			Artists: []string{},
+			Album:   "",
+			MBIDs:   MBIDs{Recording: result.ID, Release: "", Artists: []string{}},
+			Time:    time.Now(),
+		}
+		for _, credit := range result.ArtistCredit {
+			recording.Artists = append(recording.Artists, credit.Name)
+			recording.MBIDs.Artists = append(recording.MBIDs.Artists, credit.Artist.ID)
+		}
+
+		if release, ok := SelectMusicBrainzRelease(result.Releases, scrobble.Album); ok {
+			recording.Album = release.Title
+			recording.MBIDs.Release = release.ID
+		}
+
+		return recording, nil
+	}
+
+	return MusicBrainzRecording{Found: false, Artists: nil, Album: "", MBIDs: MBIDs{}, Time: time.Now()}, nil
+}
+
+// SelectMusicBrainzRelease returns the release matching the album (ignoring case), the first official album, or the
+// first release.
+func SelectMusicBrainzRelease(releases []MusicBrainzRelease, album string) (MusicBrainzRelease, bool) {
+	if len(releases) == 0 {
+		return MusicBrainzRelease{}, false
+	}
+
+	if index := slices.IndexFunc(releases, func(release MusicBrainzRelease) bool {
+		return album != "" && strings.EqualFold(release.Title, album)
+	}); index >= 0 {
+		return releases[index], true
+	}
+
+	if index := slices.IndexFunc(releases, func(release MusicBrainzRelease) bool {
+		return release.Status == "Official" && release.ReleaseGroup.PrimaryType == "Album"
+	}); index >= 0 {
+		return releases[index], true
+	}
+
+	return releases[0], true
+}
+
+// luceneEscape escapes a value used in a quoted Lucene phrase.
+func luceneEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,141 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+const musicBrainzResponse = `{
+  "recordings": [
+    {
+      "id": "low-score",
+      "score": 50,
+      "title": "Without You I'm Nothing",
+      "artist-credit": [{"name": "Someone Else", "artist": {"id": "someone-else"}}],
+      "releases": []
+    },
+    {
+      "id": "recording-id",
+      "score": 100,
+      "title": "Without You I'm Nothing",
+      "artist-credit": [
+        {"name": "Placebo", "artist": {"id": "placebo-id"}},
+        {"name": "David Bowie", "artist": {"id": "bowie-id"}}
+      ],
+      "releases": [
+        {"id": "single-id", "title": "Without You I'm Nothing", "status": "Official",
+         "release-group": {"primary-type": "Single"}},
+        {"id": "album-id", "title": "A Place For Us To Dream", "status": "Official",
+         "release-group": {"primary-type": "Album"}}
+      ]
+    }
+  ]
+}`
+
+func TestMusicBrainz(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		require.Equal(t, "/ws/2/recording", r.URL.Path)
+		require.Equal(t, main.MusicBrainzUserAgent, r.Header.Get("User-Agent"))
+
+		query := r.URL.Query().Get("query")
+		switch {
+		case strings.Contains(query, `recording:"Without You I'm Nothing"`):
+			require.Contains(t, query, `artist:"Placebo, David Bowie"`)
+			require.Contains(t, query, "dur:[241000 TO 261000]")
+			_, _ = w.Write([]byte(musicBrainzResponse))
+		case strings.Contains(query, `recording:"Error"`):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{"recordings": []}`))
+		}
+	}))
+	defer server.Close()
+
+	cacheFilename := filepath.Join(t.TempDir(), main.MusicBrainzCacheFileName)
+	config := main.MusicBrainzConfig{
+		Enabled:  true,
+		BaseURL:  server.URL + "/ws/2/",
+		Fields:   []string{main.MusicBrainzFieldAlbum, main.MusicBrainzFieldMBID},
+		MinScore: 0,
+	}
+
+	require.Nil(t, main.NewMusicBrainz(main.DefaultConfig.MusicBrainz, cacheFilename))
+	musicBrainz := main.NewMusicBrainz(config, cacheFilename)
+	require.Equal(t, main.MusicBrainzDefaultMinScore, musicBrainz.MinScore)
+
+	scrobble := defaultScrobble
+	scrobble.Album = ""
+	musicBrainz.Enrich(&scrobble)
+	require.Equal(t, 1, requests)
+	require.Equal(t, "A Place For Us To Dream", scrobble.Album)
+	require.Equal(t, defaultScrobble.Artists, scrobble.Artists)
+	require.Equal(t, main.MBIDs{
+		Recording: "recording-id",
+		Release:   "album-id",
+		Artists:   []string{"placebo-id", "bowie-id"},
+	}, scrobble.MBIDs)
+
+	// the album is not replaced, but used to select the release
+	scrobble = defaultScrobble
+	scrobble.Album = "without you i'm nothing"
+	musicBrainz = main.NewMusicBrainz(config, cacheFilename)
+	musicBrainz.Enrich(&scrobble)
+	require.Equal(t, 2, requests)
+	require.Equal(t, "without you i'm nothing", scrobble.Album)
+	require.Equal(t, "single-id", scrobble.MBIDs.Release)
+
+	// cached results are used offline
+	server.Close()
+	config.Fields = []string{main.MusicBrainzFieldArtist}
+	musicBrainz = main.NewMusicBrainz(config, cacheFilename)
+	require.Len(t, musicBrainz.Cache.Recordings, 2)
+
+	scrobble = defaultScrobble
+	scrobble.Album = ""
+	scrobble.Artists = []string{"placebo, david bowie"}
+	musicBrainz.Enrich(&scrobble)
+	require.Empty(t, scrobble.Album)
+	require.Equal(t, []string{"Placebo", "David Bowie"}, scrobble.Artists)
+	require.Empty(t, scrobble.MBIDs)
+
+	// failed lookups leave the scrobble unchanged and are not cached
+	scrobble = defaultScrobble
+	scrobble.Track = "Error"
+	musicBrainz.Enrich(&scrobble)
+	require.Equal(t, "Error", scrobble.Track)
+	require.Len(t, musicBrainz.Cache.Recordings, 2)
+}
+
+func TestMusicBrainzNotFound(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(`{"recordings": []}`))
+	}))
+	defer server.Close()
+
+	config := main.MusicBrainzConfig{
+		Enabled:  true,
+		BaseURL:  server.URL,
+		Fields:   main.MusicBrainzFields,
+		MinScore: 90,
+	}
+	musicBrainz := main.NewMusicBrainz(config, filepath.Join(t.TempDir(), main.MusicBrainzCacheFileName))
+
+	scrobble := defaultScrobble
+	musicBrainz.Enrich(&scrobble)
+	musicBrainz.Enrich(&scrobble)
+	require.Equal(t, 1, requests)
+	require.Equal(t, defaultScrobble, scrobble)
+
+	var nilMusicBrainz *main.MusicBrainz
+	nilMusicBrainz.Enrich(&scrobble)
+}
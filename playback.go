@@ -23,17 +23,34 @@ const (
 )
 
 type Scrobble struct {
-	Artists   []string
-	Track     string
-	Album     string
-	Duration  time.Duration
-	Timestamp time.Time
+	Artists   []string      `json:"artists"`
+	Track     string        `json:"track"`
+	Album     string        `json:"album"`
+	Duration  time.Duration `json:"duration"`
+	Timestamp time.Time     `json:"timestamp"`
+	MBIDs     MBIDs         `json:"mbids,omitzero"`
+}
+
+// MBIDs stores the MusicBrainz identifiers of a track, if known (see [MusicBrainz]).
+type MBIDs struct {
+	Recording string   `json:"recording,omitempty"`
+	Release   string   `json:"release,omitempty"`
+	Artists   []string `json:"artists,omitempty"`
 }
 
 type PlaybackStatus struct {
 	Scrobble
-	State    PlaybackState
-	Position time.Duration
+	State    PlaybackState  `json:"state"`
+	Position time.Duration  `json:"position"`
+	Metadata PlayerMetadata `json:"metadata"`
+}
+
+// PlayerMetadata stores additional metadata reported by a player, used to filter content that is not music (see
+// [ContentFilter]).
+type PlayerMetadata struct {
+	Genres  []string `json:"genres,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	TrackID string   `json:"track_id,omitempty"`
 }
 
 type ParsedRegexReplace struct {
@@ -126,6 +143,11 @@ func ScrobbleFromCSV(input string) (Scrobble, error) {
 		return Scrobble{}, err
 	}
 
+	return ScrobbleFromCSVRecord(parts)
+}
+
+// ScrobbleFromCSVRecord parses a record read using [csv.Reader].
+func ScrobbleFromCSVRecord(parts []string) (Scrobble, error) {
 	if len(parts) != 5 {
 		return Scrobble{}, errors.New("input has invalid number of columns")
 	}
@@ -148,6 +170,7 @@ func ScrobbleFromCSV(input string) (Scrobble, error) {
 		Album:     parts[2],
 		Duration:  duration,
 		Timestamp: timestamp.In(time.Local),
+		MBIDs:     MBIDs{},
 	}, nil
 }
 
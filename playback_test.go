@@ -19,11 +19,13 @@ var (
 		Album:     "A Place For Us To Dream",
 		Duration:  time.Duration(time.Second * 251),
 		Timestamp: time.Unix(1699225080, 0),
+		MBIDs:     main.MBIDs{},
 	}
 	defaultPlaybackStatus = main.PlaybackStatus{
 		Scrobble: defaultScrobble,
 		State:    main.PlaybackPlaying,
 		Position: time.Duration(time.Second * 110),
+		Metadata: main.PlayerMetadata{},
 	}
 )
 
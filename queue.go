@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MaxRetryQueueSize = 1000
+	MinRetryBackoff   = 30 * time.Second
+	MaxRetryBackoff   = 30 * time.Minute
+)
+
+const RetryQueueDirName = "queue"
+
+// RetryQueueFilename returns the file of the retry queue of a sink, using the key of the sink in the config file.
+func RetryQueueFilename(key string) string {
+	return filepath.Join(StateDir(), RetryQueueDirName, url.PathEscape(key)+".json")
+}
+
+type QueuedScrobble struct {
+	Player   string   `json:"player"`
+	Scrobble Scrobble `json:"scrobble"`
+	// Original is the scrobble reported by the source (only used for the event log).
+	Original Scrobble `json:"original"`
+}
+
+// RetryQueue stores scrobbles that were not saved to a sink yet. Failed requests are retried with exponential
+// backoff, scrobbles ignored by the sink are dropped.
+type RetryQueue struct {
+	Sink      Sink
+	Scrobbles []QueuedScrobble
+	// Filename is empty unless the queue is persisted (only done by `goscrobble run`), so queued scrobbles are not
+	// lost if goscrobble is restarted while a sink is unavailable.
+	Filename   string
+	Failures   int
+	RetryAfter time.Time
+	// Corrections learns the corrected metadata returned by the sink (optional).
+	Corrections *Corrections
+	EventLog    *EventLog
+	Metrics     *Metrics
+}
+
+func NewRetryQueue(sink Sink) *RetryQueue {
+	return &RetryQueue{
+		Sink:        sink,
+		Scrobbles:   []QueuedScrobble{},
+		Filename:    "",
+		Failures:    0,
+		RetryAfter:  time.Time{},
+		Corrections: nil,
+		EventLog:    nil,
+		Metrics:     nil,
+	}
+}
+
+func (q *RetryQueue) Add(player string, original, scrobble Scrobble) {
+	q.Scrobbles = append(q.Scrobbles, QueuedScrobble{Player: player, Scrobble: scrobble, Original: original})
+
+	if dropped := len(q.Scrobbles) - MaxRetryQueueSize; dropped > 0 {
+		log.Warn().
+			Str("sink", q.Sink.Name()).
+			Int("dropped", dropped).
+			Msg("retry queue is full, dropping oldest scrobbles")
+		q.Scrobbles = q.Scrobbles[dropped:]
+	}
+
+	q.save()
+}
+
+// Load adds the scrobbles from the queue file to the queue. A missing file is not an error.
+func (q *RetryQueue) Load() error {
+	//nolint:gosec
+	data, err := os.ReadFile(q.Filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var scrobbles []QueuedScrobble
+	if err := json.Unmarshal(data, &scrobbles); err != nil {
+		return err
+	}
+	q.Scrobbles = append(scrobbles, q.Scrobbles...)
+
+	log.Debug().
+		Str("sink", q.Sink.Name()).
+		Str("filename", q.Filename).
+		Int("scrobbles", len(scrobbles)).
+		Msg("loaded retry queue")
+
+	return nil
+}
+
+func (q *RetryQueue) Save() error {
+	if q.Filename == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.Filename), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(q.Scrobbles, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(q.Filename, data, 0600)
+}
+
+// save logs errors instead of returning them, the queued scrobbles are still sent if the file cannot be written.
+func (q *RetryQueue) save() {
+	if err := q.Save(); err != nil {
+		log.Error().
+			Str("filename", q.Filename).
+			Err(err).
+			Msg("error saving retry queue")
+	}
+}
+
+// Flush sends all queued scrobbles to the sink, using batch requests if the sink supports them. Desktop
+// notifications are only sent for the first failure in a row.
+func (q *RetryQueue) Flush(notifyOnError bool, notifier NotifierFunc) {
+	if len(q.Scrobbles) == 0 || time.Now().Before(q.RetryAfter) {
+		return
+	}
+
+	notify := notifyOnError && q.Failures == 0
+	pending := len(q.Scrobbles)
+
+	var err error
+	if batchSink, ok := q.Sink.(BatchSink); ok {
+		err = q.flushBatch(batchSink, notify, notifier)
+	} else {
+		err = q.flushSingle(notify, notifier)
+	}
+
+	// sent and ignored scrobbles are removed from the queue
+	if len(q.Scrobbles) != pending {
+		q.save()
+	}
+
+	if err == nil {
+		q.Failures = 0
+		q.RetryAfter = time.Time{}
+		return
+	}
+
+	q.Failures++
+	backoff := RetryBackoff(q.Failures)
+	q.RetryAfter = time.Now().Add(backoff)
+
+	log.Warn().
+		Str("sink", q.Sink.Name()).
+		Int("pending", len(q.Scrobbles)).
+		Int("failures", q.Failures).
+		Dur("backoff", backoff).
+		Msg("scrobbles will be retried")
+}
+
+func (q *RetryQueue) flushSingle(notify bool, notifier NotifierFunc) error {
+	for len(q.Scrobbles) > 0 {
+		queued := q.Scrobbles[0]
+		status := PlaybackStatus{
+			Scrobble: queued.Scrobble,
+			State:    PlaybackStopped,
+			Position: queued.Scrobble.Duration,
+			Metadata: PlayerMetadata{},
+		}
+
+		err := SendScrobble(queued.Player, q.Sink, status, notify, notifier)
+		q.record(queued, err)
+		if err != nil && IsRetryable(err) {
+			return err
+		}
+		q.Scrobbles = q.Scrobbles[1:]
+	}
+	return nil
+}
+
+func (q *RetryQueue) flushBatch(sink BatchSink, notify bool, notifier NotifierFunc) error {
+	scrobbles := make([]Scrobble, 0, len(q.Scrobbles))
+	for _, queued := range q.Scrobbles {
+		scrobbles = append(scrobbles, queued.Scrobble)
+	}
+
+	log.Debug().
+		Str("sink", sink.Name()).
+		Int("scrobbles", len(scrobbles)).
+		Msg("saving scrobble batch")
+
+	results, err := sink.ScrobbleBatch(scrobbles)
+
+	var retry []QueuedScrobble
+	var reasons []string
+	for i, result := range results {
+		queued := q.Scrobbles[i]
+		q.record(queued, result.Error)
+
+		if result.Corrected != nil {
+			if err := q.Corrections.Learn(result.Scrobble, *result.Corrected); err != nil {
+				log.Error().
+					Err(err).
+					Msg("error saving corrections")
+			}
+		}
+
+		if result.Error == nil {
+			log.Debug().
+				Str("player", queued.Player).
+				Str("sink", sink.Name()).
+				Interface("scrobble", result.Scrobble).
+				Msg("saved scrobble")
+			continue
+		}
+
+		log.Warn().
+			Str("player", queued.Player).
+			Str("sink", sink.Name()).
+			Interface("scrobble", result.Scrobble).
+			Err(result.Error).
+			Msg("scrobble was ignored by sink")
+
+		reasons = append(reasons, fmt.Sprintf("%s: %s", result.Scrobble.Track, result.Error.Error()))
+		if IsRetryable(result.Error) {
+			retry = append(retry, queued)
+		}
+	}
+	q.Scrobbles = append(retry, q.Scrobbles[len(results):]...)
+
+	log.Info().
+		Str("sink", sink.Name()).
+		Int("accepted", len(results)-len(reasons)).
+		Int("ignored", len(reasons)).
+		Int("pending", len(q.Scrobbles)).
+		Msg("saved scrobble batch")
+
+	switch {
+	case err != nil:
+		log.Error().
+			Str("sink", sink.Name()).
+			Err(err).
+			Msg("error saving scrobble batch")
+		for _, queued := range q.Scrobbles[len(retry):] {
+			q.record(queued, err)
+		}
+		NotifyError(notify, notifier,
+			fmt.Sprintf("%c error saving scrobbles (%s)", RuneWarningSign, sink.Name()),
+			fmt.Sprintf("error saving %d scrobbles: %s", len(q.Scrobbles), err.Error()),
+		)
+		return err
+	case len(reasons) > 0:
+		NotifyError(notify, notifier,
+			fmt.Sprintf("%c %d of %d scrobbles ignored (%s)", RuneWarningSign, len(reasons), len(results), sink.Name()),
+			strings.Join(reasons, "\n"),
+		)
+	}
+
+	if len(retry) > 0 {
+		return fmt.Errorf("%d scrobbles will be sent again later", len(retry))
+	}
+	return nil
+}
+
+// record adds the result of a scrobble to the event log and metrics.
+func (q *RetryQueue) record(queued QueuedScrobble, err error) {
+	q.Metrics.ObserveScrobble(q.Sink.Name(), err)
+
+	eventType := EventScrobbleSent
+	if err != nil {
+		eventType = EventScrobbleFailed
+	}
+	q.EventLog.LogScrobble(eventType, queued.Player, q.Sink.Name(), queued.Original, queued.Scrobble, err)
+}
+
+func RetryBackoff(failures int) time.Duration {
+	backoff := MinRetryBackoff
+	for i := 1; i < failures && backoff < MaxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, MaxRetryBackoff)
+}
+
+func NotifyError(notify bool, notifier NotifierFunc, summary, body string) {
+	if !notify {
+		return
+	}
+	if _, err := notifier(uint32(0), summary, body); err != nil {
+		log.Error().
+			Err(err).
+			Msg("error sending desktop notification")
+	}
+}
@@ -0,0 +1,193 @@
+package main_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+type FakeBatchSink struct {
+	FakeSink
+
+	BatchLog [][]main.Scrobble
+	Ignore   map[string]main.IgnoredError
+	Correct  map[string]string
+}
+
+func (s *FakeBatchSink) ScrobbleBatch(scrobbles []main.Scrobble) ([]main.ScrobbleResult, error) {
+	if s.Error {
+		return nil, errors.New("fake error")
+	}
+	s.BatchLog = append(s.BatchLog, scrobbles)
+
+	var results []main.ScrobbleResult
+	for _, scrobble := range scrobbles {
+		result := main.ScrobbleResult{Scrobble: scrobble, Error: nil, Corrected: nil}
+		if ignored, ok := s.Ignore[scrobble.Track]; ok {
+			result.Error = ignored
+		}
+		if track, ok := s.Correct[scrobble.Track]; ok {
+			corrected := scrobble
+			corrected.Track = track
+			result.Corrected = &corrected
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func TestRetryQueue(t *testing.T) {
+	fakeSink := FakeSink{}
+	fakeSink.Error = true
+	fakeNotifier := FakeNotifier{}
+
+	queue := main.NewRetryQueue(&fakeSink)
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Len(t, queue.Scrobbles, 2)
+	require.Equal(t, 1, queue.Failures)
+	require.True(t, queue.RetryAfter.After(time.Now()))
+	require.Equal(t, 1, fakeNotifier.Notifications)
+
+	// backoff has not expired yet
+	fakeSink.Error = false
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Len(t, queue.Scrobbles, 2)
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	queue.RetryAfter = time.Time{}
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Empty(t, queue.Scrobbles)
+	require.Len(t, fakeSink.ScrobbleLog, 2)
+	require.Equal(t, 0, queue.Failures)
+	require.Equal(t, 1, fakeNotifier.Notifications)
+}
+
+func TestRetryQueueBatch(t *testing.T) {
+	fakeSink := FakeBatchSink{}
+	fakeSink.Ignore = map[string]main.IgnoredError{
+		"Pure Morning":       {Code: 3, Reason: "timestamp too old", Retry: false},
+		"Every You Every Me": {Code: 5, Reason: "daily scrobble limit exceeded", Retry: true},
+	}
+	fakeNotifier := FakeNotifier{}
+
+	queue := main.NewRetryQueue(&fakeSink)
+
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Len(t, fakeSink.BatchLog, 1)
+	require.Empty(t, fakeSink.ScrobbleLog)
+	require.Empty(t, queue.Scrobbles)
+
+	tooOld := defaultScrobble
+	tooOld.Track = "Pure Morning"
+
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Add("fake player", tooOld, tooOld)
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Empty(t, queue.Scrobbles)
+	require.Len(t, fakeSink.BatchLog, 2)
+	require.Len(t, fakeSink.BatchLog[1], 3)
+	require.Equal(t, 0, queue.Failures)
+	require.Equal(t, 1, fakeNotifier.Notifications)
+
+	limited := defaultScrobble
+	limited.Track = "Every You Every Me"
+
+	queue.Add("fake player", limited, limited)
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Len(t, queue.Scrobbles, 1)
+	require.Equal(t, limited, queue.Scrobbles[0].Scrobble)
+	require.Equal(t, 1, queue.Failures)
+	require.Equal(t, 2, fakeNotifier.Notifications)
+
+	fakeSink.Error = true
+	queue.RetryAfter = time.Time{}
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(true, fakeNotifier.SendNotification)
+	require.Len(t, queue.Scrobbles, 2)
+	require.Equal(t, 2, queue.Failures)
+	require.Equal(t, 2, fakeNotifier.Notifications)
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, main.IsRetryable(errors.New("fake error")))
+	require.True(t, main.IsRetryable(main.IgnoredError{Code: 5, Reason: "", Retry: true}))
+	require.False(t, main.IsRetryable(main.IgnoredError{Code: 1, Reason: "", Retry: false}))
+}
+
+func TestRetryQueueCorrections(t *testing.T) {
+	fakeSink := FakeBatchSink{}
+	fakeSink.Correct = map[string]string{defaultScrobble.Track: "Without You Im Nothing"}
+
+	corrections, err := main.LoadCorrections(filepath.Join(t.TempDir(), main.CorrectionsFileName))
+	require.NoError(t, err)
+
+	queue := main.NewRetryQueue(&fakeSink)
+	queue.Corrections = corrections
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(false, nil)
+	require.Len(t, corrections.Entries, 1)
+
+	scrobble := defaultScrobble
+	require.True(t, corrections.Apply(&scrobble))
+	require.Equal(t, "Without You Im Nothing", scrobble.Track)
+}
+
+func TestRetryQueueSize(t *testing.T) {
+	queue := main.NewRetryQueue(&FakeSink{})
+	for range main.MaxRetryQueueSize + 10 {
+		queue.Add("fake player", defaultScrobble, defaultScrobble)
+	}
+	require.Len(t, queue.Scrobbles, main.MaxRetryQueueSize)
+}
+
+func TestRetryQueuePersist(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), main.RetryQueueDirName, "lastfm.default.json")
+
+	fakeSink := FakeSink{}
+	fakeSink.Error = true
+	fakeNotifier := FakeNotifier{}
+
+	queue := main.NewRetryQueue(&fakeSink)
+	queue.Filename = filename
+	queue.Add("fake player", defaultScrobble, defaultScrobble)
+	queue.Flush(false, fakeNotifier.SendNotification)
+	require.Len(t, queue.Scrobbles, 1)
+
+	// goscrobble was restarted before the sink was available again
+	fakeSink.Error = false
+	restored := main.NewRetryQueue(&fakeSink)
+	restored.Filename = filename
+	require.NoError(t, restored.Load())
+	require.Len(t, restored.Scrobbles, 1)
+	require.Equal(t, "fake player", restored.Scrobbles[0].Player)
+	require.True(t, defaultScrobble.Timestamp.Equal(restored.Scrobbles[0].Scrobble.Timestamp))
+
+	restored.Flush(false, fakeNotifier.SendNotification)
+	require.Empty(t, restored.Scrobbles)
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+
+	restored = main.NewRetryQueue(&fakeSink)
+	restored.Filename = filename
+	require.NoError(t, restored.Load())
+	require.Empty(t, restored.Scrobbles)
+
+	// a missing queue file is not an error
+	restored.Filename = filepath.Join(t.TempDir(), "missing.json")
+	require.NoError(t, restored.Load())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	require.Equal(t, main.MinRetryBackoff, main.RetryBackoff(1))
+	require.Equal(t, 2*main.MinRetryBackoff, main.RetryBackoff(2))
+	require.Equal(t, main.MaxRetryBackoff, main.RetryBackoff(100))
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// Secret-valued config fields can reference secrets stored outside the config file using these prefixes.
+const (
+	SecretEnvPrefix     = "env:"
+	SecretFilePrefix    = "file:"
+	SecretKeyringPrefix = "keyring:"
+)
+
+// KeyringApplication is the value of the `application` attribute of keyring items created by goscrobble.
+const KeyringApplication = "goscrobble"
+
+// SecretResolver resolves secret references in config values. The keyring is only opened if a value references it.
+type SecretResolver struct {
+	keyring *Keyring
+}
+
+// Resolve returns the secret referenced by value:
+//
+//   - `env:NAME`: the environment variable NAME
+//   - `file:/path`: the contents of the file, without trailing newlines
+//   - `keyring:name` or `keyring:attribute=value,...`: an item of the Secret Service keyring (see [KeyringAttributes])
+//
+// Other values are returned as-is.
+func (r *SecretResolver) Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretEnvPrefix):
+		name := strings.TrimPrefix(value, SecretEnvPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, SecretFilePrefix):
+		//nolint:gosec
+		data, err := os.ReadFile(strings.TrimPrefix(value, SecretFilePrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, SecretKeyringPrefix):
+		if r.keyring == nil {
+			keyring, err := OpenKeyring()
+			if err != nil {
+				return "", err
+			}
+			r.keyring = keyring
+		}
+		return r.keyring.Get(KeyringAttributes(strings.TrimPrefix(value, SecretKeyringPrefix)))
+	default:
+		return value, nil
+	}
+}
+
+// Close closes the keyring connection, if it was opened.
+func (r *SecretResolver) Close() {
+	if r.keyring != nil {
+		CloseLogged(r.keyring.Conn)
+	}
+}
+
+// ResolveSecrets replaces secret references in all secret-valued config fields.
+func (c *Config) ResolveSecrets(resolver *SecretResolver) error {
+	var errs []error
+	resolve := func(key string, value *string) {
+		resolved, err := resolver.Resolve(*value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot resolve secret %s: %w", key, err))
+			return
+		}
+		*value = resolved
+	}
+
+	if c.Sources.Webhook != nil {
+		webhookConfig := *c.Sources.Webhook
+		resolve("sources.webhook.secret", &webhookConfig.Secret)
+		c.Sources.Webhook = &webhookConfig
+	}
+
+	if c.Sources.LastFmProxy != nil {
+		proxyConfig := *c.Sources.LastFmProxy
+		resolve("sources.lastfm-proxy.key", &proxyConfig.Key)
+		resolve("sources.lastfm-proxy.secret", &proxyConfig.Secret)
+
+		proxyConfig.Users = maps.Clone(proxyConfig.Users)
+		for user, password := range proxyConfig.Users {
+			resolve("sources.lastfm-proxy.users."+user, &password)
+			proxyConfig.Users[user] = password
+		}
+		c.Sources.LastFmProxy = &proxyConfig
+	}
+
+	// the maps may be shared with DefaultConfig
+	c.Sources.HTTP = maps.Clone(c.Sources.HTTP)
+	for key, httpConfig := range c.Sources.HTTP {
+		resolve("sources.http."+key+".password", &httpConfig.Password)
+
+		httpConfig.Headers = maps.Clone(httpConfig.Headers)
+		for header, value := range httpConfig.Headers {
+			resolve("sources.http."+key+".headers."+header, &value)
+			httpConfig.Headers[header] = value
+		}
+		c.Sources.HTTP[key] = httpConfig
+	}
+
+	c.Sources.Jellyfin = maps.Clone(c.Sources.Jellyfin)
+	for key, jellyfinConfig := range c.Sources.Jellyfin {
+		resolve("sources.jellyfin."+key+".api_key", &jellyfinConfig.APIKey)
+		c.Sources.Jellyfin[key] = jellyfinConfig
+	}
+
+	c.Sources.Subsonic = maps.Clone(c.Sources.Subsonic)
+	for key, subsonicConfig := range c.Sources.Subsonic {
+		resolve("sources.subsonic."+key+".api_key", &subsonicConfig.APIKey)
+		resolve("sources.subsonic."+key+".password", &subsonicConfig.Password)
+		c.Sources.Subsonic[key] = subsonicConfig
+	}
+
+	c.Sinks.LastFm = maps.Clone(c.Sinks.LastFm)
+	for key, lastFmConfig := range c.Sinks.LastFm {
+		resolve("sinks.lastfm."+key+".key", &lastFmConfig.Key)
+		resolve("sinks.lastfm."+key+".secret", &lastFmConfig.Secret)
+		resolve("sinks.lastfm."+key+".session_key", &lastFmConfig.SessionKey)
+		c.Sinks.LastFm[key] = lastFmConfig
+	}
+
+	return errors.Join(errs...)
+}
+
+// KeyringAttributes parses a keyring reference. References containing `=` are comma-separated lookup attributes
+// (e.g., items stored using `secret-tool store --label=... service lastfm`), other references are the name of an
+// item created by goscrobble.
+func KeyringAttributes(reference string) map[string]string {
+	if !strings.Contains(reference, "=") {
+		return map[string]string{"application": KeyringApplication, "name": reference}
+	}
+
+	attributes := map[string]string{}
+	for pair := range strings.SplitSeq(reference, ",") {
+		name, value, _ := strings.Cut(pair, "=")
+		attributes[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return attributes
+}
+
+const (
+	secretServiceName          = "org.freedesktop.secrets"
+	secretServicePath          = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretServiceInterface     = "org.freedesktop.Secret.Service"
+	secretCollectionInterface  = "org.freedesktop.Secret.Collection"
+	secretPromptInterface      = "org.freedesktop.Secret.Prompt"
+	secretDefaultCollection    = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretKeyringPromptTimeout = 2 * time.Minute
+)
+
+// Secret is the secret struct of the Secret Service API.
+//
+// https://specifications.freedesktop.org/secret-service-spec/latest/types.html#type-Secret
+type Secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// Keyring stores and retrieves secrets using the freedesktop Secret Service API (e.g., GNOME Keyring or KWallet)
+// on the session bus. Secrets are transferred unencrypted, which is fine for the local session bus.
+//
+// https://specifications.freedesktop.org/secret-service-spec/latest/
+type Keyring struct {
+	Conn    *dbus.Conn
+	Session dbus.ObjectPath
+}
+
+func OpenKeyring() (*Keyring, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to session bus: %w", err)
+	}
+
+	keyring, err := NewKeyring(conn)
+	if err != nil {
+		CloseLogged(conn)
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// NewKeyring opens a Secret Service session using an existing connection.
+func NewKeyring(conn *dbus.Conn) (*Keyring, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+
+	err := conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open Secret Service session: %w", err)
+	}
+
+	return &Keyring{Conn: conn, Session: session}, nil
+}
+
+// Get returns the secret of the first item matching the attributes, unlocking it if necessary.
+func (k *Keyring) Get(attributes map[string]string) (string, error) {
+	service := k.Conn.Object(secretServiceName, secretServicePath)
+
+	var unlocked, locked []dbus.ObjectPath
+	if err := service.Call(secretServiceInterface+".SearchItems", 0, attributes).Store(&unlocked, &locked); err != nil {
+		return "", err
+	}
+
+	if len(unlocked) == 0 && len(locked) > 0 {
+		log.Debug().
+			Interface("attributes", attributes).
+			Msg("unlocking keyring item")
+
+		var prompt dbus.ObjectPath
+		if err := service.Call(secretServiceInterface+".Unlock", 0, locked[:1]).Store(&unlocked, &prompt); err != nil {
+			return "", err
+		}
+		if err := k.prompt(prompt); err != nil {
+			return "", err
+		}
+		unlocked = locked[:1]
+	}
+
+	if len(unlocked) == 0 {
+		return "", fmt.Errorf("no keyring item found for %v", attributes)
+	}
+
+	var secrets map[dbus.ObjectPath]Secret
+	err := service.Call(secretServiceInterface+".GetSecrets", 0, unlocked[:1], k.Session).Store(&secrets)
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := secrets[unlocked[0]]
+	if !ok {
+		return "", fmt.Errorf("keyring item %s is locked", unlocked[0])
+	}
+	return string(secret.Value), nil
+}
+
+// Set stores a secret in the default collection, replacing items with the same attributes.
+func (k *Keyring) Set(label string, attributes map[string]string, value string) error {
+	properties := map[string]dbus.Variant{
+		"org.freedesktop.Secret.Item.Label":      dbus.MakeVariant(label),
+		"org.freedesktop.Secret.Item.Attributes": dbus.MakeVariant(attributes),
+	}
+	secret := Secret{
+		Session:     k.Session,
+		Parameters:  []byte{},
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err := k.Conn.Object(secretServiceName, secretDefaultCollection).
+		Call(secretCollectionInterface+".CreateItem", 0, properties, secret, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+
+	return k.prompt(prompt)
+}
+
+// prompt shows a Secret Service prompt (e.g., to unlock the keyring) and waits until it is completed.
+func (k *Keyring) prompt(path dbus.ObjectPath) error {
+	if path == "/" || path == "" {
+		return nil
+	}
+
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(secretPromptInterface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := k.Conn.AddMatchSignal(options...); err != nil {
+		return err
+	}
+	defer func() {
+		_ = k.Conn.RemoveMatchSignal(options...)
+	}()
+
+	signals := make(chan *dbus.Signal, 1)
+	k.Conn.Signal(signals)
+	defer k.Conn.RemoveSignal(signals)
+
+	if err := k.Conn.Object(secretServiceName, path).Call(secretPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	timeout := time.After(secretKeyringPromptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != path || len(signal.Body) == 0 {
+				continue
+			}
+			if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+				return errors.New("keyring prompt was dismissed")
+			}
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for keyring prompt")
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretResolver(t *testing.T) {
+	t.Setenv("GOSCROBBLE_TEST_SECRET", "secret from env")
+
+	filename := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(filename, []byte("secret from file\n"), 0600))
+
+	resolver := main.SecretResolver{}
+	defer resolver.Close()
+
+	secret, err := resolver.Resolve("env:GOSCROBBLE_TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "secret from env", secret)
+
+	secret, err = resolver.Resolve("file:" + filename)
+	require.NoError(t, err)
+	require.Equal(t, "secret from file", secret)
+
+	secret, err = resolver.Resolve("plain secret")
+	require.NoError(t, err)
+	require.Equal(t, "plain secret", secret)
+
+	_, err = resolver.Resolve("env:GOSCROBBLE_TEST_MISSING")
+	require.ErrorContains(t, err, "GOSCROBBLE_TEST_MISSING is not set")
+
+	_, err = resolver.Resolve("file:" + filepath.Join(t.TempDir(), "missing"))
+	require.Error(t, err)
+}
+
+func TestConfigResolveSecrets(t *testing.T) {
+	t.Setenv("GOSCROBBLE_TEST_KEY", fakeLastFmKey)
+
+	config := main.DefaultConfig
+	config.Sinks.LastFm = maps.Clone(config.Sinks.LastFm)
+	lastFmConfig := config.Sinks.LastFm["default"]
+	lastFmConfig.Key = "env:GOSCROBBLE_TEST_KEY"
+	config.Sinks.LastFm["default"] = lastFmConfig
+	config.Sources.Jellyfin = map[string]main.JellyfinConfig{
+		"home": {URL: "http://localhost:8096", APIKey: "env:GOSCROBBLE_TEST_MISSING", Username: ""},
+	}
+
+	resolver := main.SecretResolver{}
+	err := config.ResolveSecrets(&resolver)
+	require.ErrorContains(t, err, "sources.jellyfin.home.api_key")
+	require.Equal(t, fakeLastFmKey, config.Sinks.LastFm["default"].Key)
+
+	config = main.DefaultConfig
+	require.NoError(t, config.ResolveSecrets(&resolver))
+	require.Equal(t, main.DefaultConfig, config)
+}
+
+func TestKeyringAttributes(t *testing.T) {
+	require.Equal(t,
+		map[string]string{"application": "goscrobble", "name": "lastfm.default.session_key"},
+		main.KeyringAttributes("lastfm.default.session_key"))
+	require.Equal(t,
+		map[string]string{"service": "lastfm", "key": "secret"},
+		main.KeyringAttributes("service=lastfm, key=secret"))
+}
+
+type FakeSecretItem struct {
+	Attributes map[string]string
+	Value      []byte
+}
+
+// FakeSecretService implements the parts of the Secret Service API used by goscrobble. Methods are called on the
+// D-Bus handler goroutine, so Items is guarded by mutex.
+type FakeSecretService struct {
+	Items map[dbus.ObjectPath]FakeSecretItem
+	mutex sync.Mutex
+}
+
+func (s *FakeSecretService) OpenSession(_ string, _ dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (s *FakeSecretService) SearchItems(
+	attributes map[string]string,
+) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	unlocked := []dbus.ObjectPath{}
+	for path, item := range s.Items {
+		if maps.Equal(item.Attributes, attributes) {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (s *FakeSecretService) GetSecrets(
+	items []dbus.ObjectPath,
+	session dbus.ObjectPath,
+) (map[dbus.ObjectPath]main.Secret, *dbus.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	secrets := map[dbus.ObjectPath]main.Secret{}
+	for _, path := range items {
+		secrets[path] = main.Secret{
+			Session:     session,
+			Parameters:  []byte{},
+			Value:       s.Items[path].Value,
+			ContentType: "text/plain",
+		}
+	}
+	return secrets, nil
+}
+
+func (s *FakeSecretService) CreateItem(
+	properties map[string]dbus.Variant,
+	secret main.Secret,
+	_ bool,
+) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attributes, ok := properties["org.freedesktop.Secret.Item.Attributes"].Value().(map[string]string)
+	if !ok {
+		return "/", "/", dbus.MakeFailedError(errors.New("invalid attributes"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", len(s.Items)+1))
+	s.Items[path] = FakeSecretItem{Attributes: attributes, Value: secret.Value}
+	return path, "/", nil
+}
+
+// ItemCount returns the number of stored items.
+func (s *FakeSecretService) ItemCount() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.Items)
+}
+
+// StartPrivateBus starts a D-Bus daemon and sets it as the session bus.
+func StartPrivateBus(t *testing.T) {
+	t.Helper()
+
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.CommandContext(ctx, "dbus-daemon", "--session", "--nofork", "--print-address", "--address="+address)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(line))
+}
+
+func TestKeyring(t *testing.T) {
+	StartPrivateBus(t)
+
+	serviceConn, err := dbus.ConnectSessionBus()
+	require.NoError(t, err)
+	defer main.CloseLogged(serviceConn)
+
+	service := &FakeSecretService{Items: map[dbus.ObjectPath]FakeSecretItem{}, mutex: sync.Mutex{}}
+	require.NoError(t, serviceConn.Export(service, "/org/freedesktop/secrets", "org.freedesktop.Secret.Service"))
+	require.NoError(t, serviceConn.Export(
+		service,
+		"/org/freedesktop/secrets/aliases/default",
+		"org.freedesktop.Secret.Collection",
+	))
+
+	reply, err := serviceConn.RequestName("org.freedesktop.secrets", dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+	require.Equal(t, dbus.RequestNameReplyPrimaryOwner, reply)
+
+	keyring, err := main.OpenKeyring()
+	require.NoError(t, err)
+	defer main.CloseLogged(keyring.Conn)
+
+	attributes := main.KeyringAttributes("lastfm.default.session_key")
+	require.NoError(t, keyring.Set("session key", attributes, "secret from keyring"))
+	require.Equal(t, 1, service.ItemCount())
+
+	secret, err := keyring.Get(attributes)
+	require.NoError(t, err)
+	require.Equal(t, "secret from keyring", secret)
+
+	_, err = keyring.Get(main.KeyringAttributes("missing"))
+	require.ErrorContains(t, err, "no keyring item found")
+
+	resolver := main.SecretResolver{}
+	defer resolver.Close()
+
+	secret, err = resolver.Resolve("keyring:lastfm.default.session_key")
+	require.NoError(t, err)
+	require.Equal(t, "secret from keyring", secret)
+}
@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 type Sink interface {
 	Name() string
@@ -8,3 +12,53 @@ type Sink interface {
 	Scrobble(Scrobble) error
 	GetScrobbles(limit int, from, to time.Time) ([]Scrobble, error)
 }
+
+// BatchSink is implemented by sinks that can save multiple scrobbles using a single request.
+type BatchSink interface {
+	Sink
+	// ScrobbleBatch returns one result per processed scrobble, in the same order as the input. If an error occurs,
+	// the returned results only cover the scrobbles that were processed before the error.
+	ScrobbleBatch([]Scrobble) ([]ScrobbleResult, error)
+}
+
+// EditSink is implemented by sinks that can delete and edit saved scrobbles (e.g., local files). Remote services
+// usually do not allow this through their API. Scrobbles are identified by their timestamp, all scrobbles with a
+// matching timestamp are changed.
+type EditSink interface {
+	Sink
+	// DeleteScrobbles returns the number of deleted scrobbles.
+	DeleteScrobbles(timestamps []time.Time) (int, error)
+	// EditScrobble replaces the scrobbles with the timestamp of the given scrobble and returns the number of edited
+	// scrobbles.
+	EditScrobble(Scrobble) (int, error)
+}
+
+type ScrobbleResult struct {
+	Scrobble Scrobble
+	// Error is set if the sink did not save the scrobble, usually an [IgnoredError].
+	Error error
+	// Corrected stores the metadata saved by the sink if it differs from the submitted scrobble.
+	Corrected *Scrobble
+}
+
+// IgnoredError is returned if a sink received a scrobble, but refused to save it (e.g., because the timestamp is
+// too old). Ignored scrobbles are only sent again if Retry is set.
+type IgnoredError struct {
+	Code   int64
+	Reason string
+	Retry  bool
+}
+
+func (e IgnoredError) Error() string {
+	return fmt.Sprintf("scrobble ignored: %s (code %d)", e.Reason, e.Code)
+}
+
+// IsRetryable reports whether a failed scrobble should be sent again later. Errors other than [IgnoredError]
+// (e.g., network errors) are always retried.
+func IsRetryable(err error) bool {
+	var ignored IgnoredError
+	if errors.As(err, &ignored) {
+		return ignored.Retry
+	}
+	return true
+}
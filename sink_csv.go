@@ -2,8 +2,11 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/csv"
+	"fmt"
 	"os"
+	"path/filepath"
 	"slices"
 	"time"
 
@@ -27,6 +30,13 @@ func (s CSVSink) NowPlaying(_ Scrobble) error {
 }
 
 func (s CSVSink) Scrobble(scrobble Scrobble) error {
+	_, err := s.ScrobbleBatch([]Scrobble{scrobble})
+	return err
+}
+
+// ScrobbleBatch appends all scrobbles using a single write, which is a lot faster than writing them one by one when
+// importing scrobbles.
+func (s CSVSink) ScrobbleBatch(batch []Scrobble) ([]ScrobbleResult, error) {
 	var scrobbles [][]string
 
 	file, err := os.Open(s.Filename)
@@ -35,21 +45,28 @@ func (s CSVSink) Scrobble(scrobble Scrobble) error {
 
 		scrobbles, err = csv.NewReader(file).ReadAll()
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else if !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 
-	scrobbles = append(scrobbles, scrobble.ToStringSlice())
+	results := make([]ScrobbleResult, 0, len(batch))
+	for _, scrobble := range batch {
+		scrobbles = append(scrobbles, scrobble.ToStringSlice())
+		results = append(results, ScrobbleResult{Scrobble: scrobble, Error: nil, Corrected: nil})
+	}
 
 	newFile, err := os.Create(s.Filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer CloseLogged(newFile)
 
-	return csv.NewWriter(newFile).WriteAll(scrobbles)
+	if err := csv.NewWriter(newFile).WriteAll(scrobbles); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 func (s CSVSink) GetScrobbles(limit int, from, to time.Time) ([]Scrobble, error) {
@@ -74,8 +91,6 @@ func (s CSVSink) GetScrobbles(limit int, from, to time.Time) ([]Scrobble, error)
 	}
 	slices.Reverse(lines)
 
-	noLimit := limit <= 0
-
 	var scrobbles []Scrobble
 	for _, line := range lines {
 		scrobble, err := ScrobbleFromCSV(line)
@@ -83,18 +98,122 @@ func (s CSVSink) GetScrobbles(limit int, from, to time.Time) ([]Scrobble, error)
 			return nil, err
 		}
 
-		if scrobble.Timestamp.Before(from) {
+		if scrobble.Timestamp.Before(from) || scrobble.Timestamp.After(to) {
 			continue
-		} else if scrobble.Timestamp.After(to) {
-			break
 		}
+		scrobbles = append(scrobbles, scrobble)
+	}
+
+	// scrobbles added later (e.g., using `goscrobble sync`) may not be sorted, but the newest scrobbles are returned
+	// first, like other sinks do
+	slices.SortStableFunc(scrobbles, func(a, b Scrobble) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+
+	if limit > 0 && len(scrobbles) > limit {
+		scrobbles = scrobbles[:limit]
+	}
+	return scrobbles, nil
+}
+
+func (s CSVSink) DeleteScrobbles(timestamps []time.Time) (int, error) {
+	return s.rewrite(func(scrobble Scrobble) ([]string, bool) {
+		if slices.ContainsFunc(timestamps, scrobble.Timestamp.Equal) {
+			return nil, true
+		}
+		return nil, false
+	})
+}
 
-		if noLimit || len(scrobbles) < limit {
-			scrobbles = append(scrobbles, scrobble)
-		} else {
-			break
+func (s CSVSink) EditScrobble(edited Scrobble) (int, error) {
+	return s.rewrite(func(scrobble Scrobble) ([]string, bool) {
+		if scrobble.Timestamp.Equal(edited.Timestamp) {
+			return edited.ToStringSlice(), true
 		}
+		return nil, false
+	})
+}
+
+// rewrite replaces (or removes, if the new record is nil) each scrobble for which update returns true, and returns
+// the number of changed scrobbles. Unchanged records are written as is. The file is replaced atomically and keeps
+// its permissions, so it is never left partially written.
+func (s CSVSink) rewrite(update func(Scrobble) ([]string, bool)) (int, error) {
+	file, err := os.Open(s.Filename)
+	if err != nil {
+		return 0, err
 	}
+	defer CloseLogged(file)
 
-	return scrobbles, nil
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var newRecords [][]string
+	for i, record := range records {
+		scrobble, err := ScrobbleFromCSVRecord(record)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		newRecord, ok := update(scrobble)
+		if !ok {
+			newRecords = append(newRecords, record)
+			continue
+		}
+
+		changed++
+		if newRecord != nil {
+			newRecords = append(newRecords, newRecord)
+		}
+	}
+
+	if changed == 0 {
+		return 0, nil
+	}
+
+	var buffer bytes.Buffer
+	if err := csv.NewWriter(&buffer).WriteAll(newRecords); err != nil {
+		return 0, err
+	}
+
+	log.Debug().
+		Str("filename", s.Filename).
+		Int("changed", changed).
+		Msg("rewriting scrobbles")
+
+	if err := WriteFileAtomic(s.Filename, buffer.Bytes(), info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// Check verifies that the CSV file can be written without modifying it. If the file does not exist yet, a
+// temporary file is created in the same directory instead.
+func (s CSVSink) Check() (string, error) {
+	//nolint:gosec
+	file, err := os.OpenFile(s.Filename, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		CloseLogged(file)
+		return s.Filename, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(s.Filename), ".goscrobble-doctor-*")
+	if err != nil {
+		return "", err
+	}
+	CloseLogged(temp)
+
+	if err := os.Remove(temp.Name()); err != nil {
+		return "", err
+	}
+	return s.Filename + " (does not exist yet)", nil
 }
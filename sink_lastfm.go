@@ -2,6 +2,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -42,26 +44,113 @@ func (s LastFmSink) Name() string {
 }
 
 func (s LastFmSink) NowPlaying(scrobble Scrobble) error {
-	_, err := s.Client.TrackUpdateNowPlaying(lastfm.P{
-		"artist":   scrobble.JoinArtists(),
-		"track":    scrobble.Track,
-		"album":    scrobble.Album,
-		"duration": max(int(scrobble.Duration.Seconds()), 30),
-		"sk":       s.SessionKey,
-	})
-	return err
+	params := lastfm.P{
+		"artist": scrobble.JoinArtists(),
+		"track":  scrobble.Track,
+		"sk":     s.SessionKey,
+	}
+	// album and duration are optional, they may be missing (see [MissingMetadataPolicy])
+	if scrobble.Album != "" {
+		params["album"] = scrobble.Album
+	}
+	if scrobble.MBIDs.Recording != "" {
+		params["mbid"] = scrobble.MBIDs.Recording
+	}
+	if scrobble.Duration > 0 {
+		params["duration"] = max(int(scrobble.Duration.Seconds()), 30)
+	}
+
+	response, err := s.Client.TrackUpdateNowPlaying(params)
+	if err != nil {
+		return err
+	}
+
+	nowPlaying := response.Nowplaying
+	if nowPlaying.Artist.Corrected == 1 || nowPlaying.Track.Corrected == 1 {
+		log.Info().
+			Str("sink", s.Name()).
+			Interface("scrobble", scrobble).
+			Str("artist", nowPlaying.Artist.Name).
+			Str("track", nowPlaying.Track.Name).
+			Msg("last.fm corrected now playing track")
+	}
+
+	return LastFmIgnoredError(nowPlaying.IgnoredMessage.Code, nowPlaying.IgnoredMessage.Message)
 }
 
 func (s LastFmSink) Scrobble(scrobble Scrobble) error {
-	_, err := s.Client.TrackScrobble(lastfm.P{
-		"artist":    scrobble.JoinArtists(),
-		"track":     scrobble.Track,
-		"album":     scrobble.Album,
-		"duration":  max(int(scrobble.Duration.Seconds()), 30),
-		"timestamp": scrobble.Timestamp.Unix(),
-		"sk":        s.SessionKey,
-	})
-	return err
+	results, err := s.ScrobbleBatch([]Scrobble{scrobble})
+	if err != nil {
+		return err
+	}
+	return results[0].Error
+}
+
+// ScrobbleBatch sends scrobbles in chunks of up to 50 tracks.
+//
+// https://www.last.fm/api/show/track.scrobble#Batch-scrobbling
+func (s LastFmSink) ScrobbleBatch(scrobbles []Scrobble) ([]ScrobbleResult, error) {
+	var results []ScrobbleResult
+
+	for chunk := range slices.Chunk(scrobbles, LastFmMaxBatchSize) {
+		params := lastfm.P{"sk": s.SessionKey}
+		for i, scrobble := range chunk {
+			params[fmt.Sprintf("artist[%d]", i)] = scrobble.JoinArtists()
+			params[fmt.Sprintf("track[%d]", i)] = scrobble.Track
+			if scrobble.Album != "" {
+				params[fmt.Sprintf("album[%d]", i)] = scrobble.Album
+			}
+			if scrobble.MBIDs.Recording != "" {
+				params[fmt.Sprintf("mbid[%d]", i)] = scrobble.MBIDs.Recording
+			}
+			if scrobble.Duration > 0 {
+				params[fmt.Sprintf("duration[%d]", i)] = max(int(scrobble.Duration.Seconds()), 30)
+			}
+			params[fmt.Sprintf("timestamp[%d]", i)] = scrobble.Timestamp.Unix()
+		}
+
+		response, err := s.Client.TrackScrobble(params)
+		if err != nil {
+			return results, err
+		}
+
+		if len(response.Scrobbles.Scrobbles) != len(chunk) {
+			return results, fmt.Errorf(
+				"last.fm returned %d results for %d scrobbles",
+				len(response.Scrobbles.Scrobbles),
+				len(chunk),
+			)
+		}
+
+		for i, result := range response.Scrobbles.Scrobbles {
+			var corrected *Scrobble
+			if result.Artist.Corrected == 1 || result.Track.Corrected == 1 || result.Album.Corrected == 1 {
+				corrected = &Scrobble{
+					// FIXME: this does not work in some cases (e.g., "Tyler, the Creator")
+					Artists:   strings.Split(result.Artist.Name, ", "),
+					Track:     result.Track.Name,
+					Album:     result.Album.Name,
+					Duration:  chunk[i].Duration,
+					Timestamp: chunk[i].Timestamp,
+					MBIDs:     chunk[i].MBIDs,
+				}
+
+				log.Info().
+					Str("sink", s.Name()).
+					Interface("scrobble", chunk[i]).
+					Interface("corrected", corrected).
+					Msg("last.fm corrected scrobble")
+			}
+
+			results = append(results, ScrobbleResult{
+				Scrobble:  chunk[i],
+				Error:     LastFmIgnoredError(result.IgnoredMessage.Code, result.IgnoredMessage.Message),
+				Corrected: corrected,
+			})
+		}
+	}
+
+	return results, nil
 }
 
 func (s LastFmSink) GetScrobbles(limit int, from, to time.Time) ([]Scrobble, error) {
@@ -100,6 +189,7 @@ outer:
 					Album:     track.Album.Name,
 					Duration:  time.Duration(0),
 					Timestamp: time.Unix(track.Date.UTS, 0),
+					MBIDs:     MBIDs{Recording: track.MBID, Release: track.Album.MBID, Artists: nil},
 				})
 			} else {
 				break outer
@@ -114,3 +204,67 @@ outer:
 
 	return scrobbles, nil
 }
+
+// https://www.last.fm/api/show/track.scrobble#Attributes
+var lastFmIgnoredReasons = map[int64]string{
+	1: "artist ignored",
+	2: "track ignored",
+	3: "timestamp too old",
+	4: "timestamp too new",
+	5: "daily scrobble limit exceeded",
+}
+
+// LastFmIgnoredError converts an `ignoredMessage` element to an [IgnoredError]. It returns nil if the scrobble
+// was accepted. Only scrobbles that exceeded the daily limit are retried.
+func LastFmIgnoredError(code int64, message string) error {
+	if code == 0 {
+		return nil
+	}
+
+	reason, ok := lastFmIgnoredReasons[code]
+	if message = strings.TrimSpace(message); message != "" {
+		reason = message
+	} else if !ok {
+		reason = "unknown reason"
+	}
+
+	return IgnoredError{Code: code, Reason: reason, Retry: code == 5}
+}
+
+// Error codes of invalid or suspended API keys.
+//
+// https://www.last.fm/api/errorcodes
+var lastFmAPIKeyErrorCodes = []int64{10, 26}
+
+// LastFmErrorCode returns the error code of a failed last.fm API request, or 0 if err is not an API error. The
+// lastfm-go client does not return typed errors, API errors are formatted as "<message> (code <code>)".
+func LastFmErrorCode(err error) int64 {
+	if err == nil {
+		return 0
+	}
+
+	message := err.Error()
+	index := strings.LastIndex(message, "(code ")
+	if index < 0 {
+		return 0
+	}
+
+	var code int64
+	if _, err := fmt.Sscanf(message[index:], "(code %d)", &code); err != nil {
+		return 0
+	}
+	return code
+}
+
+// Check validates the API key and username using user.getInfo. last.fm has no read-only endpoint to validate a
+// session key, so the session key is reported as not verified instead of sending a write request.
+func (s LastFmSink) Check() (string, error) {
+	user, err := s.Client.UserGetInfo(lastfm.P{"user": s.Username})
+	if slices.Contains(lastFmAPIKeyErrorCodes, LastFmErrorCode(err)) {
+		return "", fmt.Errorf("invalid API key: %w", err)
+	} else if err != nil {
+		return "", fmt.Errorf("cannot get user info: %w", err)
+	}
+
+	return fmt.Sprintf("found user %s (session key not verified)", user.User.Name), nil
+}
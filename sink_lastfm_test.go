@@ -0,0 +1,74 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+const lastFmScrobbleResponse = `<?xml version="1.0" encoding="utf-8"?>
+<lfm status="ok">
+	<scrobbles accepted="1" ignored="1">
+		<scrobble>
+			<track corrected="1">Without You I&apos;m Nothing</track>
+			<artist corrected="0">Placebo, David Bowie</artist>
+			<album corrected="0">A Place For Us To Dream</album>
+			<albumArtist corrected="0"></albumArtist>
+			<timestamp>1699225080</timestamp>
+			<ignoredMessage code="0"></ignoredMessage>
+		</scrobble>
+		<scrobble>
+			<track corrected="0">Pure Morning</track>
+			<artist corrected="0">Placebo</artist>
+			<album corrected="0"></album>
+			<albumArtist corrected="0"></albumArtist>
+			<timestamp>1</timestamp>
+			<ignoredMessage code="3"></ignoredMessage>
+		</scrobble>
+	</scrobbles>
+</lfm>`
+
+func TestLastFmSinkScrobbleBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(lastFmScrobbleResponse))
+	}))
+	defer server.Close()
+
+	sink, err := main.LastFmSinkFromConfig(main.LastFmConfig{
+		BaseURL:    server.URL + "/",
+		Key:        fakeLastFmKey,
+		Secret:     fakeLastFmSecret,
+		SessionKey: "session key",
+		Username:   "username",
+	})
+	require.NoError(t, err)
+
+	original := defaultScrobble
+	original.Track = "Without You Im Nothing"
+
+	results, err := sink.ScrobbleBatch([]main.Scrobble{original, defaultScrobble})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	require.NoError(t, results[0].Error)
+	require.NotNil(t, results[0].Corrected)
+	require.Equal(t, defaultScrobble, *results[0].Corrected)
+
+	require.ErrorContains(t, results[1].Error, "timestamp too old")
+	require.False(t, main.IsRetryable(results[1].Error))
+	require.Nil(t, results[1].Corrected)
+
+	_, err = sink.ScrobbleBatch([]main.Scrobble{defaultScrobble})
+	require.ErrorContains(t, err, "2 results for 1 scrobbles")
+}
+
+func TestLastFmIgnoredError(t *testing.T) {
+	require.NoError(t, main.LastFmIgnoredError(0, ""))
+	require.EqualError(t, main.LastFmIgnoredError(1, ""), "scrobble ignored: artist ignored (code 1)")
+	require.EqualError(t, main.LastFmIgnoredError(2, " Track name failed filter "), "scrobble ignored: Track name failed filter (code 2)")
+	require.True(t, main.IsRetryable(main.LastFmIgnoredError(5, "")))
+	require.EqualError(t, main.LastFmIgnoredError(99, ""), "scrobble ignored: unknown reason (code 99)")
+}
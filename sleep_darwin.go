@@ -0,0 +1,9 @@
+package main
+
+import "errors"
+
+// WatchSleep is not supported on macOS. Suspends are still detected by comparing the wall clock with the monotonic
+// clock (see [ClockWatcher]).
+func WatchSleep() (<-chan bool, error) {
+	return nil, errors.New("sleep notifications are not supported on macOS")
+}
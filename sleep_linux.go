@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	logindPath      = dbus.ObjectPath("/org/freedesktop/login1")
+	logindInterface = "org.freedesktop.login1.Manager"
+)
+
+// WatchSleep subscribes to the PrepareForSleep signal of logind on the system bus. The channel receives true before
+// the system is suspended and false after it resumed.
+//
+// https://www.freedesktop.org/software/systemd/man/latest/org.freedesktop.login1.html
+func WatchSleep() (<-chan bool, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to system bus: %w", err)
+	}
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(logindPath),
+		dbus.WithMatchInterface(logindInterface),
+		dbus.WithMatchMember("PrepareForSleep"),
+	)
+	if err != nil {
+		CloseLogged(conn)
+		return nil, err
+	}
+
+	signals := make(chan *dbus.Signal, 8)
+	conn.Signal(signals)
+
+	sleeping := make(chan bool, 1)
+	go func() {
+		for signal := range signals {
+			if signal.Name != logindInterface+".PrepareForSleep" || len(signal.Body) == 0 {
+				continue
+			}
+
+			start, ok := signal.Body[0].(bool)
+			if !ok {
+				log.Warn().
+					Interface("body", signal.Body).
+					Msg("invalid PrepareForSleep signal")
+				continue
+			}
+			sleeping <- start
+		}
+		close(sleeping)
+	}()
+
+	return sleeping, nil
+}
@@ -0,0 +1,35 @@
+package main_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSleep(t *testing.T) {
+	StartPrivateBus(t)
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", os.Getenv("DBUS_SESSION_BUS_ADDRESS"))
+
+	sleeping, err := main.WatchSleep()
+	require.NoError(t, err)
+
+	conn, err := dbus.ConnectSessionBus()
+	require.NoError(t, err)
+	defer main.CloseLogged(conn)
+
+	for _, start := range []bool{true, false} {
+		err := conn.Emit("/org/freedesktop/login1", "org.freedesktop.login1.Manager.PrepareForSleep", start)
+		require.NoError(t, err)
+
+		select {
+		case received := <-sleeping:
+			require.Equal(t, start, received)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for PrepareForSleep signal")
+		}
+	}
+}
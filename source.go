@@ -4,3 +4,11 @@ type Source interface {
 	Name() string
 	GetInfo() (map[string]PlaybackStatus, error)
 }
+
+// ScrobbleSource is implemented by sources that receive finished plays (e.g., via webhooks) in addition to the
+// playback status of players. Pending scrobbles are keyed by player and removed from the source when read. The
+// players of these sources only receive now playing updates, they are not scrobbled by the main loop.
+type ScrobbleSource interface {
+	Source
+	PendingScrobbles() map[string][]Scrobble
+}
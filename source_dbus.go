@@ -64,6 +64,16 @@ func (s DBusSource) GetInfo() (map[string]PlaybackStatus, error) {
 			continue
 		}
 
+		// optional metadata, only used for content filtering
+		genres, _ := GetDBusMapEntry[[]string](metadata, "xesam:genre")
+		url, _ := GetDBusMapEntry[string](metadata, "xesam:url")
+		trackID, err := GetDBusMapEntry[dbus.ObjectPath](metadata, "mpris:trackid")
+		if err != nil {
+			// some players report the track ID as a string
+			stringID, _ := GetDBusMapEntry[string](metadata, "mpris:trackid")
+			trackID = dbus.ObjectPath(stringID)
+		}
+
 		playbackStatus := PlaybackStatus{
 			Scrobble: Scrobble{
 				Artists:   artists,
@@ -71,9 +81,11 @@ func (s DBusSource) GetInfo() (map[string]PlaybackStatus, error) {
 				Album:     album,
 				Duration:  time.Duration(duration * int64(time.Microsecond)),
 				Timestamp: time.Time{},
+				MBIDs:     MBIDs{},
 			},
 			State:    PlaybackState(state),
 			Position: time.Duration(position * int64(time.Microsecond)),
+			Metadata: PlayerMetadata{Genres: genres, URL: url, TrackID: string(trackID)},
 		}
 
 		playerName := fmt.Sprintf("%s:%s", s.Name(), player)
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultTidalHifiEndpoint = "http://localhost:47836/current"
+	HTTPTimeout              = 10 * time.Second
+)
+
+type HTTPSource struct {
+	Client   http.Client
+	Label    string
+	URL      string
+	Headers  map[string]string
+	Username string
+	Password string
+	Fields   HTTPFieldsConfig
+}
+
+// NewHTTPClient returns a client with a timeout, so unresponsive APIs cannot block the main loop.
+func NewHTTPClient() http.Client {
+	//nolint:exhaustruct
+	return http.Client{Timeout: HTTPTimeout}
+}
+
+// HTTPSourceFromConfig labels the source with the config key (e.g., `http:home`), so multiple HTTP sources can be
+// told apart in logs and metrics.
+func HTTPSourceFromConfig(key string, c HTTPConfig) HTTPSource {
+	return HTTPSource{
+		Client:   NewHTTPClient(),
+		Label:    "http:" + key,
+		URL:      c.URL,
+		Headers:  c.Headers,
+		Username: c.Username,
+		Password: c.Password,
+		Fields:   c.Fields,
+	}
+}
+
+// TidalHifiSource returns a HTTP source preset for the tidal-hifi `/current` endpoint.
+//
+// http://localhost:47836/docs/#/current/get_current
+func TidalHifiSource(endpoint string) HTTPSource {
+	return HTTPSource{
+		Client:   NewHTTPClient(),
+		Label:    "tidal-hifi",
+		URL:      endpoint,
+		Headers:  map[string]string{},
+		Username: "",
+		Password: "",
+		Fields: HTTPFieldsConfig{
+			Artist:          "artist",
+			ArtistSeparator: ", ",
+			Track:           "title",
+			Album:           "album",
+			Duration:        "durationInSeconds",
+			DurationUnit:    "s",
+			Position:        "currentInSeconds",
+			PositionUnit:    "s",
+			State:           "status",
+			States: map[string]string{
+				"playing": string(PlaybackPlaying),
+				"paused":  string(PlaybackPaused),
+			},
+		},
+	}
+}
+
+func (s HTTPSource) Name() string {
+	return s.Label
+}
+
+func (s HTTPSource) GetInfo() (map[string]PlaybackStatus, error) {
+	request, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range s.Headers {
+		request.Header.Set(key, value)
+	}
+	if s.Username != "" || s.Password != "" {
+		request.SetBasicAuth(s.Username, s.Password)
+	}
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			log.Debug().
+				Str("source", s.Name()).
+				Str("url", s.URL).
+				Msg("connection to API refused; the player is likely not running or the API is disabled")
+			return map[string]PlaybackStatus{}, nil
+		}
+		return nil, err
+	}
+	defer CloseLogged(response.Body)
+
+	switch {
+	case response.StatusCode == http.StatusNoContent:
+		return map[string]PlaybackStatus{}, nil
+	case response.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("API returned unexpected status: %s", response.Status)
+	}
+
+	var body any
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	info, err := s.Fields.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	playerName := fmt.Sprintf("%s:%s", s.Name(), s.URL)
+	return map[string]PlaybackStatus{playerName: info}, nil
+}
+
+// Parse maps a decoded JSON document to a [PlaybackStatus] using the configured paths.
+func (f HTTPFieldsConfig) Parse(body any) (PlaybackStatus, error) {
+	artists, err := LookupJSONStrings(body, f.Artist, f.ArtistSeparator)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+	track, err := LookupJSONString(body, f.Track)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+	album, err := LookupJSONString(body, f.Album)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+	duration, err := LookupJSONDuration(body, f.Duration, f.DurationUnit)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+	position, err := LookupJSONDuration(body, f.Position, f.PositionUnit)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+	rawState, err := LookupJSONString(body, f.State)
+	if err != nil {
+		return PlaybackStatus{}, err
+	}
+
+	var state PlaybackState
+	if mapped, ok := f.States[rawState]; ok {
+		state = PlaybackState(mapped)
+	} else {
+		state = PlaybackState(rawState)
+	}
+
+	switch state {
+	case PlaybackPlaying, PlaybackPaused, PlaybackStopped:
+	default:
+		return PlaybackStatus{}, fmt.Errorf("invalid playback status returned by API: %q", rawState)
+	}
+
+	return PlaybackStatus{
+		Scrobble: Scrobble{
+			Artists:   artists,
+			Track:     track,
+			Album:     album,
+			Duration:  duration,
+			Timestamp: time.Time{},
+			MBIDs:     MBIDs{},
+		},
+		State:    state,
+		Position: position,
+		Metadata: PlayerMetadata{},
+	}, nil
+}
+
+// LookupJSON returns the value at the given dot-separated path (e.g., `item.artists.0`).
+// Returns false if the path is empty or does not exist.
+func LookupJSON(document any, path string) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+
+	current := document
+	for part := range strings.SplitSeq(path, ".") {
+		switch value := current.(type) {
+		case map[string]any:
+			next, ok := value[part]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, current != nil
+}
+
+func LookupJSONString(document any, path string) (string, error) {
+	value, ok := LookupJSON(document, path)
+	if !ok {
+		return "", nil
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		return "", fmt.Errorf("value at path %s is not a string", path)
+	}
+}
+
+// LookupJSONStrings reads a list of strings. Single strings are split using separator (if not empty).
+func LookupJSONStrings(document any, path, separator string) ([]string, error) {
+	value, ok := LookupJSON(document, path)
+	if !ok {
+		return nil, nil
+	}
+
+	switch value := value.(type) {
+	case string:
+		if separator == "" {
+			return []string{value}, nil
+		}
+		return strings.Split(value, separator), nil
+	case []any:
+		var values []string
+		for _, entry := range value {
+			entryString, ok := entry.(string)
+			if !ok {
+				return nil, fmt.Errorf("value at path %s contains non-string entries", path)
+			}
+			values = append(values, entryString)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("value at path %s is neither a string nor a list of strings", path)
+	}
+}
+
+func LookupJSONDuration(document any, path, unit string) (time.Duration, error) {
+	value, ok := LookupJSON(document, path)
+	if !ok {
+		return 0, nil
+	}
+
+	var number float64
+	var err error
+	switch value := value.(type) {
+	case float64:
+		number = value
+	case string:
+		number, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value at path %s is not a number", path)
+		}
+	default:
+		return 0, fmt.Errorf("value at path %s is not a number", path)
+	}
+
+	multiplier, err := DurationUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(number * float64(multiplier)), nil
+}
+
+func DurationUnit(unit string) (time.Duration, error) {
+	switch unit {
+	case "", "s":
+		return time.Second, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ns":
+		return time.Nanosecond, nil
+	default:
+		return 0, fmt.Errorf("invalid duration unit %q (must be s, ms, us, or ns)", unit)
+	}
+}
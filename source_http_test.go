@@ -0,0 +1,114 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTidalHifiSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{
+			"title": "Without You I'm Nothing",
+			"artist": "Placebo, David Bowie",
+			"album": "A Place For Us To Dream",
+			"status": "playing",
+			"currentInSeconds": 110,
+			"durationInSeconds": 251
+		}`))
+	}))
+	defer server.Close()
+
+	source := main.TidalHifiSource(server.URL)
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+
+	status, ok := info["tidal-hifi:"+server.URL]
+	require.True(t, ok)
+
+	expected := defaultPlaybackStatus
+	expected.Timestamp = time.Time{}
+	require.Equal(t, expected, status)
+}
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{
+			"item": {
+				"name": "Every You Every Me",
+				"artists": ["Placebo"],
+				"album": {"title": "Without You I'm Nothing"},
+				"length": 214000
+			},
+			"player": {"state": "PAUSED", "position": 12500}
+		}`))
+	}))
+	defer server.Close()
+
+	//nolint:exhaustruct
+	config := main.HTTPConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Fields: main.HTTPFieldsConfig{
+			Artist:       "item.artists",
+			Track:        "item.name",
+			Album:        "item.album.title",
+			Duration:     "item.length",
+			DurationUnit: "ms",
+			Position:     "player.position",
+			PositionUnit: "ms",
+			State:        "player.state",
+			States:       map[string]string{"PAUSED": "Paused", "PLAYING": "Playing"},
+		},
+	}
+
+	info, err := main.HTTPSourceFromConfig("home", config).GetInfo()
+	require.NoError(t, err)
+	require.Len(t, info, 1)
+	require.Equal(t, "http:home", main.HTTPSourceFromConfig("home", config).Name())
+
+	status := info["http:home:"+server.URL]
+	require.Equal(t, []string{"Placebo"}, status.Artists)
+	require.Equal(t, "Every You Every Me", status.Track)
+	require.Equal(t, "Without You I'm Nothing", status.Album)
+	require.Equal(t, 214*time.Second, status.Duration)
+	require.Equal(t, 12500*time.Millisecond, status.Position)
+	require.Equal(t, main.PlaybackPaused, status.State)
+
+	config.Headers = map[string]string{}
+	_, err = main.HTTPSourceFromConfig("home", config).GetInfo()
+	require.Error(t, err)
+}
+
+func TestLookupJSON(t *testing.T) {
+	document := map[string]any{
+		"a": map[string]any{
+			"b": []any{"first", map[string]any{"c": "second"}},
+		},
+	}
+
+	value, ok := main.LookupJSON(document, "a.b.0")
+	require.True(t, ok)
+	require.Equal(t, "first", value)
+
+	value, ok = main.LookupJSON(document, "a.b.1.c")
+	require.True(t, ok)
+	require.Equal(t, "second", value)
+
+	_, ok = main.LookupJSON(document, "a.b.2")
+	require.False(t, ok)
+
+	_, ok = main.LookupJSON(document, "a.x")
+	require.False(t, ok)
+
+	_, ok = main.LookupJSON(document, "")
+	require.False(t, ok)
+}
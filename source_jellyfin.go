@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// JellyfinTick is the unit of Jellyfin's `*Ticks` fields.
+const JellyfinTick = 100 * time.Nanosecond
+
+// https://api.jellyfin.org/#tag/Session/operation/GetSessions
+type JellyfinSession struct {
+	ID             string `json:"Id"`
+	UserName       string `json:"UserName"`
+	Client         string `json:"Client"`
+	DeviceName     string `json:"DeviceName"`
+	NowPlayingItem *struct {
+		Name         string   `json:"Name"`
+		Type         string   `json:"Type"`
+		Artists      []string `json:"Artists"`
+		Album        string   `json:"Album"`
+		RunTimeTicks int64    `json:"RunTimeTicks"`
+	} `json:"NowPlayingItem"`
+	PlayState struct {
+		PositionTicks int64 `json:"PositionTicks"`
+		IsPaused      bool  `json:"IsPaused"`
+	} `json:"PlayState"`
+}
+
+type JellyfinSource struct {
+	Client   http.Client
+	URL      string
+	APIKey   string
+	Username string
+}
+
+func JellyfinSourceFromConfig(c JellyfinConfig) JellyfinSource {
+	return JellyfinSource{
+		Client:   NewHTTPClient(),
+		URL:      strings.TrimSuffix(c.URL, "/"),
+		APIKey:   c.APIKey,
+		Username: c.Username,
+	}
+}
+
+func (s JellyfinSource) Name() string {
+	return "jellyfin"
+}
+
+func (s JellyfinSource) GetInfo() (map[string]PlaybackStatus, error) {
+	endpoint, err := url.JoinPath(s.URL, "Sessions")
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf(`MediaBrowser Token="%s"`, s.APIKey))
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseLogged(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned unexpected status: %s", response.Status)
+	}
+
+	var sessions []JellyfinSession
+	if err := json.NewDecoder(response.Body).Decode(&sessions); err != nil {
+		return nil, err
+	}
+
+	playbackStatus := map[string]PlaybackStatus{}
+
+	for _, session := range sessions {
+		item := session.NowPlayingItem
+		if item == nil || item.Type != "Audio" {
+			continue
+		}
+		if s.Username != "" && !strings.EqualFold(s.Username, session.UserName) {
+			log.Debug().
+				Str("session", session.ID).
+				Str("username", session.UserName).
+				Msg("ignoring Jellyfin session of other user")
+			continue
+		}
+
+		var state PlaybackState
+		if session.PlayState.IsPaused {
+			state = PlaybackPaused
+		} else {
+			state = PlaybackPlaying
+		}
+
+		playerName := fmt.Sprintf("%s:%s:%s", s.Name(), s.URL, session.ID)
+		playbackStatus[playerName] = PlaybackStatus{
+			Scrobble: Scrobble{
+				Artists:   item.Artists,
+				Track:     item.Name,
+				Album:     item.Album,
+				Duration:  time.Duration(item.RunTimeTicks) * JellyfinTick,
+				Timestamp: time.Time{},
+				MBIDs:     MBIDs{},
+			},
+			State:    state,
+			Position: time.Duration(session.PlayState.PositionTicks) * JellyfinTick,
+			Metadata: PlayerMetadata{},
+		}
+	}
+
+	return playbackStatus, nil
+}
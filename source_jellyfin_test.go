@@ -0,0 +1,121 @@
+package main_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+const jellyfinSessions = `[
+	{
+		"Id": "session-1",
+		"UserName": "alice",
+		"NowPlayingItem": {
+			"Name": "Without You I'm Nothing",
+			"Type": "Audio",
+			"Artists": ["Placebo", "David Bowie"],
+			"Album": "A Place For Us To Dream",
+			"RunTimeTicks": 2510000000
+		},
+		"PlayState": {"PositionTicks": 1100000000, "IsPaused": false}
+	},
+	{
+		"Id": "session-2",
+		"UserName": "Alice",
+		"NowPlayingItem": {
+			"Name": "Every You Every Me",
+			"Type": "Audio",
+			"Artists": ["Placebo"],
+			"Album": "Without You I'm Nothing",
+			"RunTimeTicks": 2140000000
+		},
+		"PlayState": {"PositionTicks": 0, "IsPaused": true}
+	},
+	{
+		"Id": "session-3",
+		"UserName": "bob",
+		"NowPlayingItem": {
+			"Name": "Pure Morning",
+			"Type": "Audio",
+			"Artists": ["Placebo"],
+			"Album": "Without You I'm Nothing",
+			"RunTimeTicks": 2540000000
+		},
+		"PlayState": {"PositionTicks": 0, "IsPaused": false}
+	},
+	{
+		"Id": "session-4",
+		"UserName": "alice",
+		"NowPlayingItem": {"Name": "Some Movie", "Type": "Movie"},
+		"PlayState": {"PositionTicks": 0, "IsPaused": false}
+	},
+	{"Id": "session-5", "UserName": "alice"}
+]`
+
+func newJellyfinServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Sessions" || r.Header.Get("Authorization") != `MediaBrowser Token="api-key"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(jellyfinSessions))
+	}))
+}
+
+func TestJellyfinSource(t *testing.T) {
+	server := newJellyfinServer(t)
+	defer server.Close()
+
+	source := main.JellyfinSourceFromConfig(main.JellyfinConfig{
+		URL:      server.URL + "/",
+		APIKey:   "api-key",
+		Username: "alice",
+	})
+
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+	require.Len(t, info, 2)
+
+	status := info["jellyfin:"+server.URL+":session-1"]
+	expected := defaultPlaybackStatus
+	expected.Timestamp = time.Time{}
+	require.Equal(t, expected, status)
+
+	status = info["jellyfin:"+server.URL+":session-2"]
+	require.Equal(t, "Every You Every Me", status.Track)
+	require.Equal(t, main.PlaybackPaused, status.State)
+
+	source.APIKey = "invalid"
+	_, err = source.GetInfo()
+	require.Error(t, err)
+}
+
+func TestJellyfinSourceMainLoop(t *testing.T) {
+	server := newJellyfinServer(t)
+	defer server.Close()
+
+	source := main.JellyfinSourceFromConfig(main.JellyfinConfig{
+		URL:      server.URL,
+		APIKey:   "api-key",
+		Username: "",
+	})
+
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+
+	main.NewMainLoop(
+		main.DefaultConfig,
+		[]main.Source{source},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	).RunOnce()
+
+	// session 1 and 3 are playing, session 2 is paused
+	require.Len(t, fakeSink.NowPlayingLog, 2)
+}
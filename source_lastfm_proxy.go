@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const DefaultLastFmProxyAddress = "127.0.0.1:42013"
+
+// LastFmProxySource implements the parts of the last.fm API 2.0 used by scrobbler apps, so they can send now
+// playing updates and scrobbles to goscrobble instead of last.fm.
+//
+// https://www.last.fm/api/mobileauth
+type LastFmProxySource struct {
+	Listener *PushListener
+	Key      string
+	Secret   string
+	Users    map[string]string
+	Pushed   *PushedPlayers
+}
+
+func LastFmProxySourceFromConfig(c LastFmProxyConfig) *LastFmProxySource {
+	var address string
+	if c.Address == "" {
+		address = DefaultLastFmProxyAddress
+	} else {
+		address = c.Address
+	}
+
+	return &LastFmProxySource{
+		Listener: NewPushListener(address),
+		Key:      c.Key,
+		Secret:   c.Secret,
+		Users:    c.Users,
+		Pushed:   NewPushedPlayers(),
+	}
+}
+
+func (s *LastFmProxySource) Name() string {
+	return "lastfm-proxy"
+}
+
+func (s *LastFmProxySource) GetInfo() (map[string]PlaybackStatus, error) {
+	if err := s.Listener.Listen(s.Name(), s.Handler()); err != nil {
+		return nil, err
+	}
+	return s.Pushed.Players(), nil
+}
+
+func (s *LastFmProxySource) PendingScrobbles() map[string][]Scrobble {
+	return s.Pushed.PendingScrobbles()
+}
+
+func (s *LastFmProxySource) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", s.handle)
+	mux.HandleFunc("POST /2.0/{$}", s.handle)
+	return mux
+}
+
+// SessionKey derives the session key of a user, so sessions do not need to be stored. Changing the password or
+// the API secret invalidates all sessions of the user.
+func (s *LastFmProxySource) SessionKey(username string) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write([]byte(username + "\x00" + s.Users[username]))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+func (s *LastFmProxySource) userForSessionKey(key string) (string, bool) {
+	for username := range s.Users {
+		if subtle.ConstantTimeCompare([]byte(s.SessionKey(username)), []byte(key)) == 1 {
+			return username, true
+		}
+	}
+	return "", false
+}
+
+func (s *LastFmProxySource) handle(w http.ResponseWriter, r *http.Request) {
+	params, err := ReadFormParams(r)
+	if err != nil {
+		WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+		return
+	}
+
+	method := params.Get("method")
+
+	log.Debug().
+		Str("source", s.Name()).
+		Str("method", method).
+		Msg("received last.fm API request")
+
+	if subtle.ConstantTimeCompare([]byte(params.Get("api_key")), []byte(s.Key)) != 1 {
+		WriteLastFmError(w, LastFmErrorInvalidAPIKey, "Invalid API key - You must be granted a valid key by last.fm")
+		return
+	}
+
+	signature := LastFmSignature(params, s.Secret)
+	if subtle.ConstantTimeCompare([]byte(params.Get("api_sig")), []byte(signature)) != 1 {
+		WriteLastFmError(w, LastFmErrorInvalidMethodSignature, "Invalid method signature supplied")
+		return
+	}
+
+	if method == "auth.getMobileSession" {
+		s.handleGetMobileSession(w, params)
+		return
+	}
+
+	username, ok := s.userForSessionKey(params.Get("sk"))
+	if !ok {
+		WriteLastFmError(w, LastFmErrorInvalidSessionKey, "Invalid session key - Please re-authenticate")
+		return
+	}
+
+	player := fmt.Sprintf("%s:%s", s.Name(), username)
+
+	switch method {
+	case "track.updateNowPlaying":
+		scrobble, err := ScrobbleFromLastFmParams(params)
+		if err != nil {
+			WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+			return
+		}
+		s.Pushed.SetNowPlaying(player, PlaybackStatus{
+			Scrobble: scrobble,
+			State:    PlaybackPlaying,
+			Position: time.Duration(0),
+			Metadata: PlayerMetadata{},
+		})
+		WriteLastFmResponse(w, LastFmNowPlayingResponse(scrobble))
+	case "track.scrobble":
+		scrobbles, err := ScrobblesFromLastFmParams(params)
+		if err != nil {
+			WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+			return
+		}
+		s.Pushed.AddScrobbles(player, scrobbles...)
+		WriteLastFmResponse(w, LastFmScrobbleResponse(scrobbles))
+	default:
+		WriteLastFmError(w, LastFmErrorInvalidMethod, "Invalid Method - No method with that name in this package")
+	}
+}
+
+func (s *LastFmProxySource) handleGetMobileSession(w http.ResponseWriter, params url.Values) {
+	username := params.Get("username")
+	password, ok := s.Users[username]
+
+	if !ok || subtle.ConstantTimeCompare([]byte(params.Get("password")), []byte(password)) != 1 {
+		log.Warn().
+			Str("source", s.Name()).
+			Str("username", username).
+			Msg("failed last.fm proxy authentication")
+		WriteLastFmError(w, LastFmErrorAuthenticationFailed, "Authentication Failed - Invalid username or password")
+		return
+	}
+
+	log.Info().
+		Str("source", s.Name()).
+		Str("username", username).
+		Msg("created last.fm proxy session")
+	WriteLastFmResponse(w, LastFmSessionResponse(username, s.SessionKey(username)))
+}
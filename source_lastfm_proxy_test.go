@@ -0,0 +1,116 @@
+package main_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	lastfm "github.com/p-mng/lastfm-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastFmProxySource(t *testing.T) {
+	source := main.LastFmProxySourceFromConfig(main.LastFmProxyConfig{
+		Address: "127.0.0.1:0",
+		Key:     fakeLastFmKey,
+		Secret:  fakeLastFmSecret,
+		Users:   map[string]string{"alice": "password"},
+	})
+
+	server := httptest.NewServer(source.Handler())
+	defer server.Close()
+
+	baseURL := server.URL + "/2.0/"
+
+	client, err := lastfm.NewMobileClient(baseURL, fakeLastFmKey, fakeLastFmSecret, "alice", "invalid")
+	require.NoError(t, err)
+	_, err = client.AuthGetMobileSession()
+	require.ErrorContains(t, err, "code 4")
+
+	client, err = lastfm.NewMobileClient(baseURL, fakeLastFmKey, "00000000000000000000000000000000", "alice", "password")
+	require.NoError(t, err)
+	_, err = client.AuthGetMobileSession()
+	require.ErrorContains(t, err, "code 13")
+
+	client, err = lastfm.NewMobileClient(baseURL, fakeLastFmKey, fakeLastFmSecret, "alice", "password")
+	require.NoError(t, err)
+	session, err := client.AuthGetMobileSession()
+	require.NoError(t, err)
+	require.Equal(t, "alice", session.Session.Name)
+	require.Equal(t, source.SessionKey("alice"), session.Session.Key)
+
+	_, err = client.TrackUpdateNowPlaying(lastfm.P{
+		"artist": "Placebo",
+		"track":  "Pure Morning",
+		"sk":     "invalid",
+	})
+	require.ErrorContains(t, err, "code 9")
+
+	_, err = client.TrackUpdateNowPlaying(lastfm.P{
+		"artist":   "Placebo",
+		"track":    "Pure Morning",
+		"album":    "Without You I'm Nothing",
+		"duration": 254,
+		"sk":       session.Session.Key,
+	})
+	require.NoError(t, err)
+
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+	require.Equal(t, "Pure Morning", info["lastfm-proxy:alice"].Track)
+
+	response, err := client.TrackScrobble(lastfm.P{
+		"artist[0]":    "Placebo",
+		"track[0]":     "Pure Morning",
+		"album[0]":     "Without You I'm Nothing",
+		"timestamp[0]": 1699225080,
+		"artist[1]":    "Placebo, David Bowie",
+		"track[1]":     "Without You I'm Nothing",
+		"timestamp[1]": 1699225334,
+		"sk":           session.Session.Key,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), response.Scrobbles.Accepted)
+
+	pending := source.PendingScrobbles()["lastfm-proxy:alice"]
+	require.Len(t, pending, 2)
+	require.Equal(t, time.Unix(1699225080, 0), pending[0].Timestamp)
+	require.Equal(t, []string{"Placebo", "David Bowie"}, pending[1].Artists)
+}
+
+func TestScrobblesFromLastFmParams(t *testing.T) {
+	scrobbles, err := main.ScrobblesFromLastFmParams(url.Values{
+		"artist":    {"Placebo"},
+		"track":     {"Pure Morning"},
+		"duration":  {"254"},
+		"timestamp": {"1699225080"},
+	})
+	require.NoError(t, err)
+	require.Len(t, scrobbles, 1)
+	require.Equal(t, 254*time.Second, scrobbles[0].Duration)
+
+	_, err = main.ScrobblesFromLastFmParams(url.Values{
+		"artist[0]": {"Placebo"},
+		"track[0]":  {"Pure Morning"},
+		"artist[1]": {"Placebo"},
+	})
+	require.Error(t, err)
+
+	_, err = main.ScrobblesFromLastFmParams(url.Values{
+		"artist":    {"Placebo"},
+		"track":     {"Pure Morning"},
+		"timestamp": {"yesterday"},
+	})
+	require.Error(t, err)
+}
+
+func TestLastFmSignature(t *testing.T) {
+	signature := main.LastFmSignature(url.Values{
+		"method":  {"auth.getSession"},
+		"api_key": {"GEYotGy8yWCqrYNgeSxabNQsZ2ztDzRw"},
+		"format":  {"json"},
+	}, "7a7bba8b9be470c7f4b8760fa4086af0")
+	require.Equal(t, "22b7af29e98e2e284206a64b1868d6fb", signature)
+}
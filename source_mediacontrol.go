@@ -52,9 +52,11 @@ func (s MediaControlSource) GetInfo() (map[string]PlaybackStatus, error) {
 			Album:     outputParsed.Album,
 			Duration:  time.Duration(outputParsed.Duration * float64(time.Second)),
 			Timestamp: outputParsed.Timestamp,
+			MBIDs:     MBIDs{},
 		},
 		State:    state,
 		Position: time.Duration(outputParsed.ElapsedTimeNow * float64(time.Second)),
+		Metadata: PlayerMetadata{},
 	}
 
 	playerName := fmt.Sprintf("%s:%s", s.Name(), outputParsed.BundleIdentifier)
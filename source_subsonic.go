@@ -0,0 +1,138 @@
+package main
+
+import (
+	//nolint:gosec
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const SubsonicAPIVersion = "1.16.1"
+
+// http://www.subsonic.org/pages/api.jsp#getNowPlaying
+type SubsonicNowPlayingResponse struct {
+	Response struct {
+		Status string `json:"status"`
+		Error  struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		NowPlaying struct {
+			Entries []struct {
+				Title      string `json:"title"`
+				Artist     string `json:"artist"`
+				Album      string `json:"album"`
+				Duration   int    `json:"duration"`
+				Username   string `json:"username"`
+				MinutesAgo int    `json:"minutesAgo"`
+				PlayerID   int    `json:"playerId"`
+				PlayerName string `json:"playerName"`
+			} `json:"entry"`
+		} `json:"nowPlaying"`
+	} `json:"subsonic-response"`
+}
+
+type SubsonicSource struct {
+	Client   http.Client
+	URL      string
+	APIKey   string
+	Username string
+	Password string
+}
+
+func SubsonicSourceFromConfig(c SubsonicConfig) SubsonicSource {
+	return SubsonicSource{
+		Client:   NewHTTPClient(),
+		URL:      strings.TrimSuffix(c.URL, "/"),
+		APIKey:   c.APIKey,
+		Username: c.Username,
+		Password: c.Password,
+	}
+}
+
+func (s SubsonicSource) Name() string {
+	return "subsonic"
+}
+
+func (s SubsonicSource) GetInfo() (map[string]PlaybackStatus, error) {
+	endpoint, err := url.JoinPath(s.URL, "rest", "getNowPlaying.view")
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("v", SubsonicAPIVersion)
+	query.Set("c", "goscrobble")
+	query.Set("f", "json")
+
+	if s.APIKey != "" {
+		// https://opensubsonic.netlify.app/docs/extensions/apikeyauth/
+		query.Set("apiKey", s.APIKey)
+	} else {
+		salt := rand.Text()
+		//nolint:gosec
+		token := md5.Sum([]byte(s.Password + salt))
+
+		query.Set("u", s.Username)
+		query.Set("t", hex.EncodeToString(token[:]))
+		query.Set("s", salt)
+	}
+
+	response, err := s.Client.Get(endpoint + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer CloseLogged(response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned unexpected status: %s", response.Status)
+	}
+
+	var body SubsonicNowPlayingResponse
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if body.Response.Status != "ok" {
+		return nil, fmt.Errorf("%s (code %d)", body.Response.Error.Message, body.Response.Error.Code)
+	}
+
+	playbackStatus := map[string]PlaybackStatus{}
+
+	for _, entry := range body.Response.NowPlaying.Entries {
+		if s.Username != "" && !strings.EqualFold(s.Username, entry.Username) {
+			log.Debug().
+				Str("username", entry.Username).
+				Str("player", entry.PlayerName).
+				Msg("ignoring Subsonic player of other user")
+			continue
+		}
+
+		// getNowPlaying does not report the playback position or pause state, only the
+		// number of minutes since the track started
+		playerName := fmt.Sprintf("%s:%s:%s:%d", s.Name(), s.URL, entry.Username, entry.PlayerID)
+		playbackStatus[playerName] = PlaybackStatus{
+			Scrobble: Scrobble{
+				Artists:   []string{entry.Artist},
+				Track:     entry.Title,
+				Album:     entry.Album,
+				Duration:  time.Duration(entry.Duration) * time.Second,
+				Timestamp: time.Time{},
+				MBIDs:     MBIDs{},
+			},
+			State:    PlaybackPlaying,
+			Position: time.Duration(entry.MinutesAgo) * time.Minute,
+			Metadata: PlayerMetadata{},
+		}
+	}
+
+	return playbackStatus, nil
+}
@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	//nolint:gosec
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubsonicSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		//nolint:gosec
+		token := md5.Sum([]byte("password" + query.Get("s")))
+		if r.URL.Path != "/rest/getNowPlaying.view" ||
+			query.Get("u") != "alice" ||
+			query.Get("t") != hex.EncodeToString(token[:]) {
+			_, _ = w.Write([]byte(`{"subsonic-response": {
+				"status": "failed",
+				"error": {"code": 40, "message": "Wrong username or password"}
+			}}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"subsonic-response": {
+			"status": "ok",
+			"nowPlaying": {"entry": [
+				{
+					"title": "Every You Every Me",
+					"artist": "Placebo",
+					"album": "Without You I'm Nothing",
+					"duration": 214,
+					"username": "alice",
+					"minutesAgo": 2,
+					"playerId": 7,
+					"playerName": "phone"
+				},
+				{
+					"title": "Pure Morning",
+					"artist": "Placebo",
+					"album": "Without You I'm Nothing",
+					"duration": 254,
+					"username": "bob",
+					"minutesAgo": 0,
+					"playerId": 8,
+					"playerName": "tv"
+				}
+			]}
+		}}`))
+	}))
+	defer server.Close()
+
+	source := main.SubsonicSourceFromConfig(main.SubsonicConfig{
+		URL:      server.URL,
+		APIKey:   "",
+		Username: "alice",
+		Password: "password",
+	})
+
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+	require.Len(t, info, 1)
+
+	status, ok := info["subsonic:"+server.URL+":alice:7"]
+	require.True(t, ok)
+	require.Equal(t, []string{"Placebo"}, status.Artists)
+	require.Equal(t, "Every You Every Me", status.Track)
+	require.Equal(t, 214*time.Second, status.Duration)
+	require.Equal(t, 2*time.Minute, status.Position)
+	require.Equal(t, main.PlaybackPlaying, status.State)
+
+	source.Password = "invalid"
+	_, err = source.GetInfo()
+	require.ErrorContains(t, err, "Wrong username or password")
+}
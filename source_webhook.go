@@ -0,0 +1,350 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultWebhookAddress      = "127.0.0.1:42012"
+	WebhookSecretHeader        = "X-Goscrobble-Secret"
+	WebhookMaxBodySize         = 1 << 20
+	PushedPlayerTimeout        = 1 * time.Minute
+	PushedPlayerUnknownTimeout = 10 * time.Minute
+)
+
+// WebhookEvent is the JSON body accepted by the `/now-playing` and `/scrobble` endpoints.
+type WebhookEvent struct {
+	Player    string   `json:"player"`
+	Artists   []string `json:"artists"`
+	Track     string   `json:"track"`
+	Album     string   `json:"album"`
+	Duration  float64  `json:"duration"`
+	Position  float64  `json:"position"`
+	State     string   `json:"state"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// PushedPlayers stores the playback status and finished plays received by push-based sources.
+type PushedPlayers struct {
+	mutex     sync.Mutex
+	players   map[string]pushedPlayer
+	scrobbles map[string][]Scrobble
+}
+
+type pushedPlayer struct {
+	Status  PlaybackStatus
+	Expires time.Time
+}
+
+func NewPushedPlayers() *PushedPlayers {
+	return &PushedPlayers{
+		mutex:     sync.Mutex{},
+		players:   map[string]pushedPlayer{},
+		scrobbles: map[string][]Scrobble{},
+	}
+}
+
+// SetNowPlaying updates the status of a player. Players that are not updated expire after the remaining track
+// duration, stopped players are removed immediately.
+func (p *PushedPlayers) SetNowPlaying(player string, status PlaybackStatus) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if status.State == PlaybackStopped {
+		delete(p.players, player)
+		return
+	}
+
+	var timeout time.Duration
+	if status.State == PlaybackPlaying && status.Duration > 0 {
+		timeout = max(status.Duration-status.Position, 0) + PushedPlayerTimeout
+	} else {
+		timeout = PushedPlayerUnknownTimeout
+	}
+
+	p.players[player] = pushedPlayer{Status: status, Expires: time.Now().Add(timeout)}
+}
+
+func (p *PushedPlayers) AddScrobbles(player string, scrobbles ...Scrobble) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.scrobbles[player] = append(p.scrobbles[player], scrobbles...)
+}
+
+func (p *PushedPlayers) Players() map[string]PlaybackStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	players := map[string]PlaybackStatus{}
+
+	for player, entry := range p.players {
+		if now.After(entry.Expires) {
+			log.Debug().
+				Str("player", player).
+				Msg("pushed player status expired")
+			delete(p.players, player)
+			continue
+		}
+		players[player] = entry.Status
+	}
+
+	return players
+}
+
+func (p *PushedPlayers) PendingScrobbles() map[string][]Scrobble {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pending := p.scrobbles
+	p.scrobbles = map[string][]Scrobble{}
+
+	return pending
+}
+
+// PushListener starts the HTTP server of a push-based source on first use.
+type PushListener struct {
+	Address string
+
+	mutex    sync.Mutex
+	listener net.Listener
+}
+
+func NewPushListener(address string) *PushListener {
+	return &PushListener{Address: address, mutex: sync.Mutex{}, listener: nil}
+}
+
+// Listen starts serving handler unless the listener is already running.
+func (l *PushListener) Listen(name string, handler http.Handler) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.listener != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", l.Address)
+	if err != nil {
+		return err
+	}
+	l.listener = listener
+
+	log.Info().
+		Str("source", name).
+		Str("address", listener.Addr().String()).
+		Msg("listening for HTTP requests")
+
+	//nolint:exhaustruct
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().
+				Err(err).
+				Str("source", name).
+				Str("address", l.Address).
+				Msg("HTTP server stopped")
+		}
+	}()
+
+	return nil
+}
+
+type WebhookSource struct {
+	Listener *PushListener
+	Secret   string
+	Pushed   *PushedPlayers
+}
+
+func WebhookSourceFromConfig(c WebhookConfig) *WebhookSource {
+	var address string
+	if c.Address == "" {
+		address = DefaultWebhookAddress
+	} else {
+		address = c.Address
+	}
+
+	return &WebhookSource{
+		Listener: NewPushListener(address),
+		Secret:   c.Secret,
+		Pushed:   NewPushedPlayers(),
+	}
+}
+
+func (s *WebhookSource) Name() string {
+	return "webhook"
+}
+
+// GetInfo starts the HTTP listener on the first call and returns the status of all players that pushed updates.
+func (s *WebhookSource) GetInfo() (map[string]PlaybackStatus, error) {
+	if err := s.Listener.Listen(s.Name(), s.Handler()); err != nil {
+		return nil, err
+	}
+	return s.Pushed.Players(), nil
+}
+
+func (s *WebhookSource) PendingScrobbles() map[string][]Scrobble {
+	return s.Pushed.PendingScrobbles()
+}
+
+func (s *WebhookSource) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /now-playing", s.handleEvent(false))
+	mux.HandleFunc("POST /scrobble", s.handleEvent(true))
+	mux.HandleFunc("POST /{$}", s.handleLastFm)
+	mux.HandleFunc("POST /2.0/{$}", s.handleLastFm)
+	return mux
+}
+
+func (s *WebhookSource) authorized(r *http.Request, params url.Values) bool {
+	if s.Secret == "" {
+		return true
+	}
+
+	provided := r.Header.Get(WebhookSecretHeader)
+	if provided == "" && params != nil {
+		// last.fm clients cannot send custom headers, accept the secret as session key instead
+		provided = params.Get("sk")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(s.Secret)) == 1
+}
+
+func (s *WebhookSource) handleEvent(scrobble bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r, nil) {
+			http.Error(w, "invalid secret", http.StatusUnauthorized)
+			return
+		}
+
+		var event WebhookEvent
+		if err := json.NewDecoder(io.LimitReader(r.Body, WebhookMaxBodySize)).Decode(&event); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+
+		status, err := event.PlaybackStatus()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		player := fmt.Sprintf("%s:%s", s.Name(), event.PlayerName())
+
+		log.Debug().
+			Str("player", player).
+			Bool("scrobble", scrobble).
+			Interface("status", status).
+			Msg("received webhook event")
+
+		if scrobble {
+			if event.Timestamp == 0 && status.Duration > 0 {
+				// the play finished when it was pushed, scrobbles use the start of playback
+				status.Timestamp = time.Now().Add(-status.Duration)
+			}
+			s.Pushed.AddScrobbles(player, status.Scrobble)
+		} else {
+			s.Pushed.SetNowPlaying(player, status)
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *WebhookSource) handleLastFm(w http.ResponseWriter, r *http.Request) {
+	params, err := ReadFormParams(r)
+	if err != nil {
+		WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+		return
+	}
+
+	if !s.authorized(r, params) {
+		WriteLastFmError(w, LastFmErrorInvalidSessionKey, "Invalid session key")
+		return
+	}
+
+	player := fmt.Sprintf("%s:lastfm", s.Name())
+
+	switch params.Get("method") {
+	case "track.updateNowPlaying":
+		scrobble, err := ScrobbleFromLastFmParams(params)
+		if err != nil {
+			WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+			return
+		}
+		s.Pushed.SetNowPlaying(player, PlaybackStatus{
+			Scrobble: scrobble,
+			State:    PlaybackPlaying,
+			Position: time.Duration(0),
+			Metadata: PlayerMetadata{},
+		})
+		WriteLastFmResponse(w, LastFmNowPlayingResponse(scrobble))
+	case "track.scrobble":
+		scrobbles, err := ScrobblesFromLastFmParams(params)
+		if err != nil {
+			WriteLastFmError(w, LastFmErrorInvalidParameters, err.Error())
+			return
+		}
+		s.Pushed.AddScrobbles(player, scrobbles...)
+		WriteLastFmResponse(w, LastFmScrobbleResponse(scrobbles))
+	default:
+		WriteLastFmError(w, LastFmErrorInvalidMethod, "Invalid Method - No method with that name in this package")
+	}
+}
+
+func (e WebhookEvent) PlayerName() string {
+	if e.Player == "" {
+		return "default"
+	}
+	return e.Player
+}
+
+func (e WebhookEvent) PlaybackStatus() (PlaybackStatus, error) {
+	if len(e.Artists) == 0 || e.Track == "" {
+		return PlaybackStatus{}, errors.New("artists and track are required")
+	}
+
+	var state PlaybackState
+	switch PlaybackState(e.State) {
+	case "", PlaybackPlaying:
+		state = PlaybackPlaying
+	case PlaybackPaused:
+		state = PlaybackPaused
+	case PlaybackStopped:
+		state = PlaybackStopped
+	default:
+		return PlaybackStatus{}, fmt.Errorf("invalid state %q (must be Playing, Paused, or Stopped)", e.State)
+	}
+
+	var timestamp time.Time
+	if e.Timestamp == 0 {
+		timestamp = time.Now()
+	} else {
+		timestamp = time.Unix(e.Timestamp, 0)
+	}
+
+	return PlaybackStatus{
+		Scrobble: Scrobble{
+			Artists:   e.Artists,
+			Track:     e.Track,
+			Album:     e.Album,
+			Duration:  time.Duration(e.Duration * float64(time.Second)),
+			Timestamp: timestamp,
+			MBIDs:     MBIDs{},
+		},
+		State:    state,
+		Position: time.Duration(e.Position * float64(time.Second)),
+		Metadata: PlayerMetadata{},
+	}, nil
+}
@@ -0,0 +1,207 @@
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	lastfm "github.com/p-mng/lastfm-go"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fakeLastFmKey    = "91856cb7960b9f7751fd4a16c7bb3492"
+	fakeLastFmSecret = "7a7bba8b9be470c7f4b8760fa4086af0"
+)
+
+func postWebhook(t *testing.T, url, secret, body string) int {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	if secret != "" {
+		request.Header.Set(main.WebhookSecretHeader, secret)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	main.CloseLogged(response.Body)
+
+	return response.StatusCode
+}
+
+func TestWebhookSource(t *testing.T) {
+	source := main.WebhookSourceFromConfig(main.WebhookConfig{Address: "127.0.0.1:0", Secret: "s3cret"})
+
+	server := httptest.NewServer(source.Handler())
+	defer server.Close()
+
+	nowPlaying := `{
+		"player": "kitchen",
+		"artists": ["Placebo", "David Bowie"],
+		"track": "Without You I'm Nothing",
+		"album": "A Place For Us To Dream",
+		"duration": 251,
+		"position": 110
+	}`
+
+	require.Equal(t, http.StatusUnauthorized, postWebhook(t, server.URL+"/now-playing", "", nowPlaying))
+	require.Equal(t, http.StatusBadRequest, postWebhook(t, server.URL+"/now-playing", "s3cret", `{"track": ""}`))
+	require.Equal(t, http.StatusAccepted, postWebhook(t, server.URL+"/now-playing", "s3cret", nowPlaying))
+
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+	require.Len(t, info, 1)
+
+	status := info["webhook:kitchen"]
+	require.Equal(t, defaultPlaybackStatus.Artists, status.Artists)
+	require.Equal(t, main.PlaybackPlaying, status.State)
+	require.Equal(t, 110*time.Second, status.Position)
+
+	require.Equal(t, http.StatusAccepted, postWebhook(
+		t,
+		server.URL+"/now-playing",
+		"s3cret",
+		`{"player": "kitchen", "artists": ["Placebo"], "track": "Pure Morning", "state": "Stopped"}`,
+	))
+
+	info, err = source.GetInfo()
+	require.NoError(t, err)
+	require.Empty(t, info)
+
+	require.Equal(t, http.StatusAccepted, postWebhook(
+		t,
+		server.URL+"/scrobble",
+		"s3cret",
+		`{"artists": ["Placebo"], "track": "Pure Morning", "album": "Without You I'm Nothing", "timestamp": 1699225080}`,
+	))
+
+	pending := source.PendingScrobbles()
+	require.Len(t, pending["webhook:default"], 1)
+	require.Equal(t, time.Unix(1699225080, 0), pending["webhook:default"][0].Timestamp)
+	require.Empty(t, source.PendingScrobbles())
+}
+
+func TestWebhookSourceScrobbleWithoutTimestamp(t *testing.T) {
+	source := main.WebhookSourceFromConfig(main.WebhookConfig{Address: "127.0.0.1:0", Secret: ""})
+
+	server := httptest.NewServer(source.Handler())
+	defer server.Close()
+
+	received := time.Now()
+	require.Equal(t, http.StatusAccepted, postWebhook(
+		t,
+		server.URL+"/scrobble",
+		"",
+		`{"artists": ["Placebo"], "track": "Pure Morning", "duration": 254}`,
+	))
+	require.Equal(t, http.StatusAccepted, postWebhook(
+		t,
+		server.URL+"/scrobble",
+		"",
+		`{"artists": ["Placebo"], "track": "Pure Morning"}`,
+	))
+
+	// the play started one track duration before it was pushed
+	pending := source.PendingScrobbles()["webhook:default"]
+	require.Len(t, pending, 2)
+	require.WithinDuration(t, received.Add(-254*time.Second), pending[0].Timestamp, time.Second)
+	// the current time is used if the duration is unknown
+	require.WithinDuration(t, received, pending[1].Timestamp, time.Second)
+}
+
+func TestWebhookSourceLastFm(t *testing.T) {
+	source := main.WebhookSourceFromConfig(main.WebhookConfig{Address: "127.0.0.1:0", Secret: "s3cret"})
+
+	server := httptest.NewServer(source.Handler())
+	defer server.Close()
+
+	client, err := lastfm.NewDesktopClient(server.URL+"/2.0/", fakeLastFmKey, fakeLastFmSecret)
+	require.NoError(t, err)
+
+	_, err = client.TrackUpdateNowPlaying(lastfm.P{
+		"artist": "Placebo",
+		"track":  "Pure Morning",
+		"sk":     "invalid",
+	})
+	require.ErrorContains(t, err, "code 9")
+
+	_, err = client.TrackUpdateNowPlaying(lastfm.P{
+		"artist":   "Placebo",
+		"track":    "Pure Morning",
+		"album":    "Without You I'm Nothing",
+		"duration": 254,
+		"sk":       "s3cret",
+	})
+	require.NoError(t, err)
+
+	info, err := source.GetInfo()
+	require.NoError(t, err)
+	require.Equal(t, "Pure Morning", info["webhook:lastfm"].Track)
+
+	response, err := client.TrackScrobble(lastfm.P{
+		"artist":    "Placebo",
+		"track":     "Pure Morning",
+		"album":     "Without You I'm Nothing",
+		"timestamp": 1699225080,
+		"sk":        "s3cret",
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), response.Scrobbles.Accepted)
+
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+
+	main.NewMainLoop(
+		main.DefaultConfig,
+		[]main.Source{source},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	).RunOnce()
+
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+	require.Equal(t, time.Unix(1699225080, 0), fakeSink.ScrobbleLog[0].Timestamp)
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+}
+
+func TestWebhookSourceScrobbledOnce(t *testing.T) {
+	source := main.WebhookSourceFromConfig(main.WebhookConfig{Address: "127.0.0.1:0", Secret: ""})
+
+	server := httptest.NewServer(source.Handler())
+	defer server.Close()
+
+	fakeSink := &FakeSink{}
+	fakeNotifier := FakeNotifier{}
+	loop := main.NewMainLoop(
+		main.DefaultConfig,
+		[]main.Source{source},
+		[]main.Sink{fakeSink},
+		fakeNotifier.SendNotification,
+	)
+
+	event := `{
+		"artists": ["Placebo"],
+		"track": "Pure Morning",
+		"album": "Without You I'm Nothing",
+		"duration": 254,
+		"position": %d
+	}`
+
+	require.Equal(t, http.StatusAccepted, postWebhook(t, server.URL+"/now-playing", "", fmt.Sprintf(event, 10)))
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+
+	// the minimum playback time is reached, but the player reports the finished play itself
+	require.Equal(t, http.StatusAccepted, postWebhook(t, server.URL+"/now-playing", "", fmt.Sprintf(event, 200)))
+	loop.RunOnce()
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	require.Equal(t, http.StatusAccepted, postWebhook(t, server.URL+"/scrobble", "", fmt.Sprintf(event, 254)))
+	loop.RunOnce()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+}
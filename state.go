@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const StateFileName = "state.json"
+
+// StateRestoreTolerance is added to the time since the start of playback when checking if the position reported
+// by a player is plausible for a restored track.
+const StateRestoreTolerance = 10 * time.Second
+
+func StateFilename() string {
+	return filepath.Join(StateDir(), StateFileName)
+}
+
+// PlayerState is the persisted state of a player. Status.Timestamp is the start of playback, Status.Position is
+// the last position reported by the player.
+type PlayerState struct {
+	Status    PlaybackStatus `json:"status"`
+	Scrobbled bool           `json:"scrobbled"`
+}
+
+// DaemonState persists the state of all players, so a restart of goscrobble during playback does not lose or
+// duplicate scrobbles. All methods are no-ops if the state is nil.
+type DaemonState struct {
+	Filename string                 `json:"-"`
+	Players  map[string]PlayerState `json:"players"`
+
+	// restorable stores the players loaded from the state file that were not seen yet.
+	restorable map[string]PlayerState
+}
+
+// LoadDaemonState returns an empty state if the state file does not exist.
+func LoadDaemonState(filename string) (*DaemonState, error) {
+	state := &DaemonState{Filename: filename, Players: map[string]PlayerState{}, restorable: nil}
+
+	//nolint:gosec
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return state, err
+	}
+	if state.Players == nil {
+		state.Players = map[string]PlayerState{}
+	}
+	state.restorable = maps.Clone(state.Players)
+
+	log.Debug().
+		Str("filename", filename).
+		Int("players", len(state.Players)).
+		Msg("loaded state")
+
+	return state, nil
+}
+
+// Restore returns the saved state of a player if it is still playing the same track. The position must not be
+// smaller than the saved position (the track was not restarted) or larger than the time since the start of
+// playback.
+func (s *DaemonState) Restore(player string, status PlaybackStatus) (PlayerState, bool) {
+	if s == nil {
+		return PlayerState{}, false
+	}
+
+	saved, ok := s.restorable[player]
+	if !ok {
+		return PlayerState{}, false
+	}
+	delete(s.restorable, player)
+
+	switch {
+	case status.State != PlaybackPlaying:
+		return PlayerState{}, false
+	case !saved.Status.Equals(status):
+		return PlayerState{}, false
+	case status.Position < saved.Status.Position:
+		return PlayerState{}, false
+	case status.Position > time.Since(saved.Status.Timestamp)+StateRestoreTolerance:
+		return PlayerState{}, false
+	default:
+		return saved, true
+	}
+}
+
+// Update replaces the state of all players. The state file is only written if a player started a new track or
+// scrobbled, not if positions changed. Players from the state file that were not restored are discarded.
+func (s *DaemonState) Update(players map[string]PlayerState) {
+	if s == nil {
+		return
+	}
+	s.restorable = nil
+
+	changed := len(players) != len(s.Players)
+	for player, state := range players {
+		previous, ok := s.Players[player]
+		if !ok || !previous.Status.Equals(state.Status) ||
+			!previous.Status.Timestamp.Equal(state.Status.Timestamp) || previous.Scrobbled != state.Scrobbled {
+			changed = true
+		}
+	}
+	s.Players = players
+
+	if !changed {
+		return
+	}
+
+	if err := s.Save(); err != nil {
+		log.Error().
+			Str("filename", s.Filename).
+			Err(err).
+			Msg("error saving state")
+	}
+}
+
+func (s *DaemonState) Save() error {
+	if s == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.Filename), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFileAtomic(s.Filename, data, 0600)
+}
@@ -0,0 +1,137 @@
+package main_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDaemonState(t *testing.T, players map[string]main.PlayerState) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), main.StateFileName)
+	data, err := json.Marshal(map[string]any{"players": players})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filename, data, 0600))
+
+	return filename
+}
+
+func TestDaemonState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", main.StateFileName)
+
+	state, err := main.LoadDaemonState(filename)
+	require.NoError(t, err)
+	require.Empty(t, state.Players)
+
+	status := defaultPlaybackStatus
+	status.Timestamp = time.Now().Add(-time.Minute).UTC().Round(0)
+
+	state.Update(map[string]main.PlayerState{"fake player": {Status: status, Scrobbled: false}})
+	require.FileExists(t, filename)
+
+	// only the position changed
+	require.NoError(t, os.Remove(filename))
+	status.Position += time.Second
+	state.Update(map[string]main.PlayerState{"fake player": {Status: status, Scrobbled: false}})
+	require.NoFileExists(t, filename)
+
+	state.Update(map[string]main.PlayerState{"fake player": {Status: status, Scrobbled: true}})
+	require.FileExists(t, filename)
+
+	loaded, err := main.LoadDaemonState(filename)
+	require.NoError(t, err)
+	require.Equal(t, state.Players, loaded.Players)
+
+	var nilState *main.DaemonState
+	nilState.Update(map[string]main.PlayerState{})
+	require.NoError(t, nilState.Save())
+	_, ok := nilState.Restore("fake player", status)
+	require.False(t, ok)
+}
+
+func TestDaemonStateRestore(t *testing.T) {
+	saved := defaultPlaybackStatus
+	saved.Timestamp = time.Now().Add(-time.Minute)
+	saved.Position = 50 * time.Second
+
+	filename := writeDaemonState(t, map[string]main.PlayerState{
+		"fake player": {Status: saved, Scrobbled: true},
+	})
+
+	restore := func(status main.PlaybackStatus) bool {
+		state, err := main.LoadDaemonState(filename)
+		require.NoError(t, err)
+		_, ok := state.Restore("fake player", status)
+		return ok
+	}
+
+	status := defaultPlaybackStatus
+	status.Position = 55 * time.Second
+	require.True(t, restore(status))
+
+	// restarted
+	status.Position = 5 * time.Second
+	require.False(t, restore(status))
+
+	// longer than the time since the start of playback
+	status.Position = 5 * time.Minute
+	require.False(t, restore(status))
+
+	status.Position = 55 * time.Second
+	status.State = main.PlaybackPaused
+	require.False(t, restore(status))
+
+	status = defaultPlaybackStatus
+	status.Position = 55 * time.Second
+	status.Track = "Pure Morning"
+	require.False(t, restore(status))
+
+	state, err := main.LoadDaemonState(filename)
+	require.NoError(t, err)
+	_, ok := state.Restore("other player", defaultPlaybackStatus)
+	require.False(t, ok)
+}
+
+func TestMainLoopRestoreState(t *testing.T) {
+	saved := defaultPlaybackStatus
+	saved.Timestamp = time.Now().Add(-250 * time.Second).UTC().Round(0)
+	saved.Position = 245 * time.Second
+
+	fakeSource := &FakeSource{}
+	fakeSource.PlaybackStatus = defaultPlaybackStatus
+	fakeSource.PlaybackStatus.Position = 248 * time.Second
+	fakeSink := &FakeSink{}
+
+	newLoop := func() *main.MainLoop {
+		filename := writeDaemonState(t, map[string]main.PlayerState{
+			"fake player": {Status: saved, Scrobbled: true},
+		})
+		state, err := main.LoadDaemonState(filename)
+		require.NoError(t, err)
+
+		loop := main.NewMainLoop(main.DefaultConfig, []main.Source{fakeSource}, []main.Sink{fakeSink}, nil)
+		loop.State = state
+		return loop
+	}
+
+	loop := newLoop()
+	loop.RunOnce()
+	require.Empty(t, fakeSink.NowPlayingLog)
+	require.Empty(t, fakeSink.ScrobbleLog)
+	require.True(t, loop.ScrobbledPrevious["fake player"])
+	require.Equal(t, saved.Timestamp, loop.PreviouslyPlaying["fake player"].Timestamp)
+	require.Equal(t, 248*time.Second, loop.State.Players["fake player"].Status.Position)
+
+	// the track was restarted, so it is scrobbled again
+	fakeSource.PlaybackStatus.Position = 0
+	loop = newLoop()
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.False(t, loop.ScrobbledPrevious["fake player"])
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultStreamPattern splits ICY-style titles ("Artist - Title").
+const DefaultStreamPattern = `^(?P<artist>.+?) - (?P<track>.+)$`
+
+// DefaultStreamListenThreshold is used if no listen threshold is configured for a stream.
+const DefaultStreamListenThreshold = 60 * time.Second
+
+// Stream parses the titles reported by an internet radio player, which usually contain artist and track in a single
+// field and no album or duration. Each title change is a new track, tracks are scrobbled after ListenThreshold.
+type Stream struct {
+	Player          *regexp.Regexp
+	Patterns        []*regexp.Regexp
+	Ignore          []*regexp.Regexp
+	ListenThreshold time.Duration
+}
+
+func (c Config) ParseStreams() []Stream {
+	var streams []Stream
+
+	compile := func(expression string) (*regexp.Regexp, bool) {
+		compiled, err := regexp.Compile(expression)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("expression", expression).
+				Msg("error compiling stream expression")
+			return nil, false
+		}
+		return compiled, true
+	}
+
+	for _, s := range c.Streams {
+		player, ok := compile(s.Player)
+		if !ok {
+			continue
+		}
+
+		patterns := s.Patterns
+		if len(patterns) == 0 {
+			patterns = []string{DefaultStreamPattern}
+		}
+
+		stream := Stream{
+			Player:          player,
+			Patterns:        []*regexp.Regexp{},
+			Ignore:          []*regexp.Regexp{},
+			ListenThreshold: time.Duration(s.ListenThreshold) * time.Second,
+		}
+		if stream.ListenThreshold <= 0 {
+			stream.ListenThreshold = DefaultStreamListenThreshold
+		}
+
+		for _, expression := range patterns {
+			if pattern, ok := compile(expression); ok {
+				stream.Patterns = append(stream.Patterns, pattern)
+			}
+		}
+		for _, expression := range s.Ignore {
+			if ignore, ok := compile(expression); ok {
+				stream.Ignore = append(stream.Ignore, ignore)
+			}
+		}
+
+		streams = append(streams, stream)
+	}
+
+	return streams
+}
+
+// ParseTitle splits a stream title into artist and track using the first matching pattern (with the named groups
+// `artist` and `track`). It returns false if the title is ignored (e.g., station IDs and ads) or does not match any
+// pattern.
+func (s Stream) ParseTitle(title string) (string, string, bool) {
+	for _, ignore := range s.Ignore {
+		if ignore.MatchString(title) {
+			return "", "", false
+		}
+	}
+
+	for _, pattern := range s.Patterns {
+		match := pattern.FindStringSubmatch(title)
+		if match == nil {
+			continue
+		}
+
+		artistIndex := pattern.SubexpIndex("artist")
+		trackIndex := pattern.SubexpIndex("track")
+		if artistIndex < 0 || trackIndex < 0 || match[artistIndex] == "" || match[trackIndex] == "" {
+			continue
+		}
+		return match[artistIndex], match[trackIndex], true
+	}
+
+	return "", "", false
+}
+
+// Stream returns the first stream matching the player.
+func (l *MainLoop) Stream(player string) (Stream, bool) {
+	for _, stream := range l.Streams {
+		if stream.Player.MatchString(player) {
+			return stream, true
+		}
+	}
+	return Stream{}, false
+}
+
+// ParseStream replaces artist and track of stream players with the parsed title. Album, duration, and position
+// are cleared, since they refer to the stream and not the track. Titles that cannot be parsed are cleared, so the
+// player is treated like a player without a track.
+func (l *MainLoop) ParseStream(player string, status *PlaybackStatus) {
+	stream, ok := l.Stream(player)
+	if !ok {
+		return
+	}
+
+	title := status.Track
+	artist, track, ok := stream.ParseTitle(title)
+	if ok {
+		status.Artists = []string{artist}
+		status.Track = track
+	} else {
+		log.Debug().
+			Str("player", player).
+			Str("title", title).
+			Msg("ignoring stream title")
+		status.Artists = nil
+		status.Track = ""
+	}
+
+	status.Album = ""
+	status.Duration = 0
+	status.Position = 0
+}
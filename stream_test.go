@@ -0,0 +1,82 @@
+package main_test
+
+import (
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+var radioConfig = main.StreamConfig{
+	Player:          "^fake player$",
+	Patterns:        []string{`^(?P<track>.+) by (?P<artist>.+)$`, main.DefaultStreamPattern},
+	Ignore:          []string{"(?i)you are listening to", "(?i)^advert"},
+	ListenThreshold: 0,
+}
+
+func TestStreamParseTitle(t *testing.T) {
+	config := main.DefaultConfig
+	config.Streams = []main.StreamConfig{radioConfig}
+	streams := config.ParseStreams()
+	require.Len(t, streams, 1)
+	require.Equal(t, main.DefaultStreamListenThreshold, streams[0].ListenThreshold)
+
+	parse := func(title string) []string {
+		artist, track, ok := streams[0].ParseTitle(title)
+		if !ok {
+			return nil
+		}
+		return []string{artist, track}
+	}
+
+	require.Equal(t, []string{"Placebo", "Pure Morning"}, parse("Placebo - Pure Morning"))
+	require.Equal(t, []string{"Placebo", "Pure Morning - Radio Edit"}, parse("Placebo - Pure Morning - Radio Edit"))
+	require.Equal(t, []string{"Placebo", "Pure Morning"}, parse("Pure Morning by Placebo"))
+	require.Nil(t, parse("You are listening to Radio Goscrobble"))
+	require.Nil(t, parse("Advertisement - Buy Now"))
+	require.Nil(t, parse("Radio Goscrobble"))
+}
+
+func TestMainLoopStream(t *testing.T) {
+	fakeSource := &FakeSource{
+		PlayerName:     "",
+		Empty:          false,
+		Error:          false,
+		PlaybackStatus: defaultPlaybackStatus,
+	}
+	fakeSource.PlaybackStatus.Artists = []string{"Radio Goscrobble"}
+	fakeSource.PlaybackStatus.Track = "Placebo - Pure Morning"
+	fakeSource.PlaybackStatus.Duration = 0
+	fakeSource.PlaybackStatus.Position = 2 * time.Hour
+	fakeSink := &FakeSink{}
+
+	config := main.DefaultConfig
+	config.Streams = []main.StreamConfig{radioConfig}
+	loop := main.NewMainLoop(config, []main.Source{fakeSource}, []main.Sink{fakeSink}, nil)
+
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+	require.Equal(t, []string{"Placebo"}, fakeSink.NowPlayingLog[0].Artists)
+	require.Equal(t, "Pure Morning", fakeSink.NowPlayingLog[0].Track)
+	require.Empty(t, fakeSink.NowPlayingLog[0].Album)
+
+	// the stream position is ignored
+	loop.RunOnce()
+	require.Empty(t, fakeSink.ScrobbleLog)
+
+	status := loop.PreviouslyPlaying["fake player"]
+	status.Timestamp = time.Now().Add(-main.DefaultStreamListenThreshold)
+	loop.PreviouslyPlaying["fake player"] = status
+
+	loop.RunOnce()
+	require.Len(t, fakeSink.ScrobbleLog, 1)
+
+	fakeSource.PlaybackStatus.Track = "You are listening to Radio Goscrobble"
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 1)
+
+	fakeSource.PlaybackStatus.Track = "Placebo - Every You Every Me"
+	loop.RunOnce()
+	require.Len(t, fakeSink.NowPlayingLog, 2)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// DefaultSyncTolerance is the maximum timestamp difference of matching scrobbles, since players (e.g., phone apps)
+// may report slightly different timestamps for the same playback.
+const DefaultSyncTolerance = 30 * time.Second
+
+// SyncDiff is the result of comparing the scrobbles of two sinks, using [CompareScrobbles].
+type SyncDiff struct {
+	// Missing stores scrobbles of the source sink that were not found in the target sink.
+	Missing []Scrobble
+	// Extra stores scrobbles of the target sink that were not found in the source sink.
+	Extra []Scrobble
+	// Matched is the number of scrobbles found in both sinks.
+	Matched int
+}
+
+// CompareScrobbles matches each source scrobble with the closest target scrobble of the same track (see
+// [IsSameTrack]) with a timestamp difference of at most tolerance. Each target scrobble is matched at most once, so
+// repeated plays are compared individually. Missing and Extra are sorted by timestamp.
+func CompareScrobbles(source, target []Scrobble, tolerance time.Duration) SyncDiff {
+	byTimestamp := func(a, b Scrobble) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	}
+
+	source = slices.SortedFunc(slices.Values(source), byTimestamp)
+	target = slices.SortedFunc(slices.Values(target), byTimestamp)
+	matched := make([]bool, len(target))
+
+	diff := SyncDiff{Missing: []Scrobble{}, Extra: []Scrobble{}, Matched: 0}
+
+	for _, scrobble := range source {
+		distance := func(i int) time.Duration {
+			return target[i].Timestamp.Sub(scrobble.Timestamp).Abs()
+		}
+
+		// index of the first target scrobble within the tolerance
+		start, _ := slices.BinarySearchFunc(target, scrobble.Timestamp.Add(-tolerance), func(s Scrobble, t time.Time) int {
+			return s.Timestamp.Compare(t)
+		})
+
+		best := -1
+		for i := start; i < len(target) && distance(i) <= tolerance; i++ {
+			if !matched[i] && IsSameTrack(scrobble, target[i]) && (best < 0 || distance(i) < distance(best)) {
+				best = i
+			}
+		}
+
+		if best < 0 {
+			diff.Missing = append(diff.Missing, scrobble)
+			continue
+		}
+		matched[best] = true
+		diff.Matched++
+	}
+
+	for i, scrobble := range target {
+		if !matched[i] {
+			diff.Extra = append(diff.Extra, scrobble)
+		}
+	}
+
+	return diff
+}
+
+// FilterScrobbles removes scrobbles outside of the time range (e.g., the currently playing track returned by
+// last.fm, which has no timestamp).
+func FilterScrobbles(scrobbles []Scrobble, from, to time.Time) []Scrobble {
+	return slices.DeleteFunc(scrobbles, func(scrobble Scrobble) bool {
+		return scrobble.Timestamp.Before(from) || scrobble.Timestamp.After(to)
+	})
+}
@@ -0,0 +1,96 @@
+package main_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	main "github.com/p-mng/goscrobble"
+	"github.com/stretchr/testify/require"
+)
+
+func syncScrobble(artist, track string, timestamp time.Time) main.Scrobble {
+	return main.Scrobble{
+		Artists:   []string{artist},
+		Track:     track,
+		Album:     "",
+		Duration:  0,
+		Timestamp: timestamp,
+		MBIDs:     main.MBIDs{},
+	}
+}
+
+func TestCompareScrobbles(t *testing.T) {
+	start := time.Unix(1699225080, 0)
+
+	source := []main.Scrobble{
+		syncScrobble("Placebo", "Pure Morning", start.Add(10*time.Minute)),
+		syncScrobble("Placebo", "Pure Morning", start),
+		syncScrobble("Placebo", "Every You Every Me", start.Add(4*time.Minute)),
+		syncScrobble("Placebo", "Pure Morning", start.Add(20*time.Minute)),
+	}
+	target := []main.Scrobble{
+		// different case and timestamp, both repeated plays match
+		syncScrobble("placebo", "pure morning ", start.Add(10*time.Second)),
+		syncScrobble("Placebo", "Pure Morning", start.Add(10*time.Minute-5*time.Second)),
+		// outside of the tolerance
+		syncScrobble("Placebo", "Every You Every Me", start.Add(5*time.Minute)),
+		syncScrobble("Placebo", "Special K", start.Add(20*time.Minute)),
+	}
+
+	diff := main.CompareScrobbles(source, target, main.DefaultSyncTolerance)
+	require.Equal(t, 2, diff.Matched)
+	require.Equal(t, []main.Scrobble{source[2], source[3]}, diff.Missing)
+	require.Equal(t, []main.Scrobble{target[2], target[3]}, diff.Extra)
+
+	diff = main.CompareScrobbles(source, nil, main.DefaultSyncTolerance)
+	require.Equal(t, 0, diff.Matched)
+	require.Len(t, diff.Missing, 4)
+	require.True(t, diff.Missing[0].Timestamp.Equal(start))
+	require.Empty(t, diff.Extra)
+}
+
+func TestCompareScrobblesClosestMatch(t *testing.T) {
+	start := time.Unix(1699225080, 0)
+
+	source := []main.Scrobble{
+		syncScrobble("Placebo", "Pure Morning", start),
+	}
+	target := []main.Scrobble{
+		syncScrobble("Placebo", "Pure Morning", start.Add(20*time.Second)),
+		syncScrobble("Placebo", "Pure Morning", start.Add(-5*time.Second)),
+	}
+
+	diff := main.CompareScrobbles(source, target, main.DefaultSyncTolerance)
+	require.Equal(t, 1, diff.Matched)
+	require.Empty(t, diff.Missing)
+	require.Equal(t, []main.Scrobble{target[0]}, diff.Extra)
+}
+
+func TestFilterScrobbles(t *testing.T) {
+	start := time.Unix(1699225080, 0)
+
+	scrobbles := []main.Scrobble{
+		syncScrobble("Placebo", "Pure Morning", time.Unix(0, 0)),
+		syncScrobble("Placebo", "Pure Morning", start),
+		syncScrobble("Placebo", "Pure Morning", start.Add(time.Hour)),
+	}
+
+	filtered := main.FilterScrobbles(scrobbles, start, start.Add(time.Minute))
+	require.Len(t, filtered, 1)
+	require.True(t, filtered[0].Timestamp.Equal(start))
+}
+
+func TestCSVSinkGetScrobblesUnsorted(t *testing.T) {
+	sink := main.CSVSink{Filename: filepath.Join(t.TempDir(), "scrobbles.csv")}
+
+	start := time.Date(2026, 10, 18, 20, 0, 0, 0, time.Local)
+	for _, offset := range []time.Duration{0, time.Hour, 30 * time.Minute} {
+		require.NoError(t, sink.Scrobble(syncScrobble("Placebo", "Pure Morning", start.Add(offset))))
+	}
+
+	scrobbles, err := sink.GetScrobbles(0, start.Add(45*time.Minute), start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, scrobbles, 1)
+	require.True(t, scrobbles[0].Timestamp.Equal(start.Add(time.Hour)))
+}